@@ -0,0 +1,267 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// AnnotationError describes an ingress annotation whose value can't be used.
+type AnnotationError struct {
+	// Annotation is the name of the annotation.
+	Annotation string
+	// Value is the value of the annotation.
+	Value string
+	// Reason explains why the value can't be used, and is intended to be shown to users.
+	Reason string
+	// fallback describes the value used instead, when invalid annotations aren't rejected.
+	fallback string
+	// setFallback sets the fallback on the entry, if it isn't the value the entry already has.
+	setFallback func(*IngressEntry)
+}
+
+func (e *AnnotationError) Error() string {
+	return fmt.Sprintf("invalid %s annotation [%s]: %s", e.Annotation, e.Value, e.Reason)
+}
+
+const usingDefault = "the default"
+
+// AnnotationHandler parses an ingress annotation into an IngressEntry.
+type AnnotationHandler struct {
+	// Annotation is the name of the handled annotation, such as sky.uk/strip-path.
+	Annotation string
+	// Parse sets fields or Attributes of the entry from the value of the annotation. It's only called for
+	// ingresses with the annotation. If the value is invalid, Parse should leave the entry unchanged and
+	// return an error explaining why, which is reported on the ingress.
+	Parse func(value string, entry *IngressEntry) error
+}
+
+// AnnotationRegistry holds the handlers of the annotations understood by the controller.
+// Handlers run in the order they're registered, so later handlers can override earlier ones.
+type AnnotationRegistry struct {
+	handlers []AnnotationHandler
+}
+
+// NewAnnotationRegistry creates a registry with handlers for the built-in sky.uk annotations.
+// Further handlers can be registered before it's passed to the controller.
+func NewAnnotationRegistry() *AnnotationRegistry {
+	r := &AnnotationRegistry{}
+	for _, handler := range builtinAnnotationHandlers() {
+		if err := r.Register(handler); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// Register adds the handler of an annotation. Returns an error if the annotation already has a handler.
+func (r *AnnotationRegistry) Register(handler AnnotationHandler) error {
+	if handler.Annotation == "" {
+		return errors.New("annotation handler has no annotation")
+	}
+	if handler.Parse == nil {
+		return fmt.Errorf("annotation handler for %s has no Parse func", handler.Annotation)
+	}
+	for _, h := range r.handlers {
+		if h.Annotation == handler.Annotation {
+			return fmt.Errorf("annotation %s is already registered", handler.Annotation)
+		}
+	}
+	r.handlers = append(r.handlers, handler)
+	return nil
+}
+
+// parse runs the handler of each annotation the ingress has, returning the annotations with invalid values.
+func (r *AnnotationRegistry) parse(annotations map[string]string, entry *IngressEntry) []*AnnotationError {
+	var annotationErrs []*AnnotationError
+	for _, handler := range r.handlers {
+		value, ok := annotations[handler.Annotation]
+		if !ok {
+			continue
+		}
+		if err := handler.Parse(value, entry); err != nil {
+			annotationErr := toAnnotationError(handler.Annotation, value, err)
+			if annotationErr.setFallback != nil {
+				annotationErr.setFallback(entry)
+			}
+			annotationErrs = append(annotationErrs, annotationErr)
+		}
+	}
+	return annotationErrs
+}
+
+func toAnnotationError(annotation, value string, err error) *AnnotationError {
+	annotationErr, ok := err.(*AnnotationError)
+	if !ok {
+		annotationErr = &AnnotationError{Reason: err.Error()}
+	}
+	annotationErr.Annotation = annotation
+	annotationErr.Value = value
+	if annotationErr.fallback == "" {
+		annotationErr.fallback = usingDefault
+	}
+	return annotationErr
+}
+
+func builtinAnnotationHandlers() []AnnotationHandler {
+	return []AnnotationHandler{
+		enumAnnotation(legacyFrontendElbSchemeAnnotation, lbSchemes, func(e *IngressEntry) *string { return &e.LbScheme }),
+		enumAnnotation(frontendSchemeAnnotation, lbSchemes, func(e *IngressEntry) *string { return &e.LbScheme }),
+		{Annotation: ingressAllowAnnotation, Parse: parseAllow},
+		boolAnnotation(stripPathAnnotation, func(e *IngressEntry) *bool { return &e.StripPaths }),
+		boolAnnotation(exactPathAnnotation, func(e *IngressEntry) *bool { return &e.ExactPath }),
+		intAnnotation(legacyBackendKeepaliveSeconds, 1, math.MaxInt32, func(e *IngressEntry) *int { return &e.BackendTimeoutSeconds }),
+		intAnnotation(backendTimeoutSeconds, 1, math.MaxInt32, func(e *IngressEntry) *int { return &e.BackendTimeoutSeconds }),
+		intAnnotation(backendMaxConnections, 0, math.MaxInt32, func(e *IngressEntry) *int { return &e.BackendMaxConnections }),
+		cappedIntAnnotation(proxyBufferSizeAnnotation, 1, maxAllowedProxyBufferSize, func(e *IngressEntry) *int { return &e.ProxyBufferSize }),
+		cappedIntAnnotation(proxyBufferBlocksAnnotation, 1, maxAllowedProxyBufferBlocks, func(e *IngressEntry) *int { return &e.ProxyBufferBlocks }),
+		boolAnnotation(routeToEndpointsAnnotation, func(e *IngressEntry) *bool { return &e.RouteToEndpoints }),
+		{Annotation: tlsProfileAnnotation, Parse: func(value string, entry *IngressEntry) error {
+			entry.TLSProfile = value
+			return nil
+		}},
+		boolAnnotation(httpsRedirectAnnotation, func(e *IngressEntry) *bool { return &e.HTTPSRedirect }),
+		{Annotation: httpsRedirectCodeAnnotation, Parse: parseHTTPSRedirectCode},
+		{Annotation: hstsMaxAgeSecondsAnnotation, Parse: parseHSTSMaxAgeSeconds},
+		boolAnnotation(hstsIncludeSubDomainsAnnotation, func(e *IngressEntry) *bool { return &e.HSTSIncludeSubDomains }),
+		boolAnnotation(hstsPreloadAnnotation, func(e *IngressEntry) *bool { return &e.HSTSPreload }),
+		{Annotation: rateLimitAnnotation, Parse: parseRateLimit},
+		intAnnotation(rateLimitBurstAnnotation, 0, math.MaxInt32, func(e *IngressEntry) *int { return &e.RateLimitBurst }),
+		{Annotation: rateLimitKeyAnnotation, Parse: parseRateLimitKey},
+	}
+}
+
+func parseAllow(value string, entry *IngressEntry) error {
+	if value == "" {
+		entry.Allow = []string{}
+	} else {
+		entry.Allow = strings.Split(value, ",")
+	}
+	return nil
+}
+
+func parseHTTPSRedirectCode(value string, entry *IngressEntry) error {
+	switch value {
+	case "301":
+		entry.HTTPSRedirectCode = 301
+	case "308":
+		entry.HTTPSRedirectCode = 308
+	default:
+		return &AnnotationError{Reason: "must be 301 or 308"}
+	}
+	return nil
+}
+
+// parseHSTSMaxAgeSeconds enables HSTS. A max-age of 0 tells browsers to forget a previous policy.
+func parseHSTSMaxAgeSeconds(value string, entry *IngressEntry) error {
+	maxAge, err := strconv.Atoi(value)
+	if err != nil {
+		return &AnnotationError{Reason: "must be a whole number"}
+	}
+	if maxAge < 0 {
+		return &AnnotationError{Reason: rangeReason(0, math.MaxInt32)}
+	}
+	entry.HSTS = true
+	entry.HSTSMaxAgeSeconds = maxAge
+	return nil
+}
+
+var (
+	rateLimitPattern  = regexp.MustCompile(`^[1-9][0-9]*r/[sm]$`)
+	headerNamePattern = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+)
+
+func parseRateLimit(value string, entry *IngressEntry) error {
+	if !rateLimitPattern.MatchString(value) {
+		return &AnnotationError{Reason: "must be requests per second or minute, such as 10r/s or 600r/m",
+			fallback: "no limit"}
+	}
+	entry.RateLimit = value
+	return nil
+}
+
+// parseRateLimitKey parses client-ip, or header:<name> to limit the clients identified by a request header.
+func parseRateLimitKey(value string, entry *IngressEntry) error {
+	if value == "client-ip" {
+		entry.RateLimitHeader = ""
+		return nil
+	}
+	header := strings.TrimPrefix(value, "header:")
+	if header == value || !headerNamePattern.MatchString(header) {
+		return &AnnotationError{Reason: "must be client-ip or header:<name>", fallback: "the client IP"}
+	}
+	entry.RateLimitHeader = header
+	return nil
+}
+
+func boolAnnotation(annotation string, field func(*IngressEntry) *bool) AnnotationHandler {
+	return AnnotationHandler{Annotation: annotation, Parse: func(value string, entry *IngressEntry) error {
+		switch value {
+		case "true":
+			*field(entry) = true
+		case "false":
+			*field(entry) = false
+		default:
+			return &AnnotationError{Reason: "must be true or false"}
+		}
+		return nil
+	}}
+}
+
+// intAnnotation parses a whole number between min and max inclusive.
+func intAnnotation(annotation string, min, max int, field func(*IngressEntry) *int) AnnotationHandler {
+	return AnnotationHandler{Annotation: annotation, Parse: func(value string, entry *IngressEntry) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return &AnnotationError{Reason: "must be a whole number"}
+		}
+		if n < min || n > max {
+			return &AnnotationError{Reason: rangeReason(min, max)}
+		}
+		*field(entry) = n
+		return nil
+	}}
+}
+
+// cappedIntAnnotation parses a whole number of at least min. Values above max are invalid, but the registry uses
+// max instead of the default for them.
+func cappedIntAnnotation(annotation string, min, max int, field func(*IngressEntry) *int) AnnotationHandler {
+	return AnnotationHandler{Annotation: annotation, Parse: func(value string, entry *IngressEntry) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return &AnnotationError{Reason: "must be a whole number"}
+		}
+		if n < min {
+			return &AnnotationError{Reason: rangeReason(min, max)}
+		}
+		if n > max {
+			return &AnnotationError{Reason: rangeReason(min, max), fallback: strconv.Itoa(max),
+				setFallback: func(e *IngressEntry) { *field(e) = max }}
+		}
+		*field(entry) = n
+		return nil
+	}}
+}
+
+// enumAnnotation parses one of the allowed values.
+func enumAnnotation(annotation string, allowed []string, field func(*IngressEntry) *string) AnnotationHandler {
+	return AnnotationHandler{Annotation: annotation, Parse: func(value string, entry *IngressEntry) error {
+		for _, a := range allowed {
+			if value == a {
+				*field(entry) = value
+				return nil
+			}
+		}
+		return &AnnotationError{Reason: fmt.Sprintf("must be one of %s", strings.Join(allowed, ", "))}
+	}}
+}
+
+func rangeReason(min, max int) string {
+	if max == math.MaxInt32 {
+		return fmt.Sprintf("must be at least %d", min)
+	}
+	return fmt.Sprintf("must be between %d and %d", min, max)
+}
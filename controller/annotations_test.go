@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuiltinAnnotationHandlers(t *testing.T) {
+	asserter := assert.New(t)
+
+	var tests = []struct {
+		description string
+		annotations map[string]string
+		handler     AnnotationHandler
+		field       func(e *IngressEntry) interface{}
+		expected    interface{}
+		errors      []string
+	}{
+		{
+			"missing bool keeps the default",
+			map[string]string{},
+			boolAnnotation("b", func(e *IngressEntry) *bool { return &e.StripPaths }),
+			func(e *IngressEntry) interface{} { return e.StripPaths },
+			true,
+			nil,
+		},
+		{
+			"valid bool",
+			map[string]string{"b": "false"},
+			boolAnnotation("b", func(e *IngressEntry) *bool { return &e.StripPaths }),
+			func(e *IngressEntry) interface{} { return e.StripPaths },
+			false,
+			nil,
+		},
+		{
+			"invalid bool keeps the default",
+			map[string]string{"b": "yes"},
+			boolAnnotation("b", func(e *IngressEntry) *bool { return &e.StripPaths }),
+			func(e *IngressEntry) interface{} { return e.StripPaths },
+			true,
+			[]string{"invalid b annotation [yes]: must be true or false"},
+		},
+		{
+			"valid int",
+			map[string]string{"i": "20"},
+			intAnnotation("i", 1, math.MaxInt32, func(e *IngressEntry) *int { return &e.BackendTimeoutSeconds }),
+			func(e *IngressEntry) interface{} { return e.BackendTimeoutSeconds },
+			20,
+			nil,
+		},
+		{
+			"int with a typo keeps the default",
+			map[string]string{"i": "2O"},
+			intAnnotation("i", 1, math.MaxInt32, func(e *IngressEntry) *int { return &e.BackendTimeoutSeconds }),
+			func(e *IngressEntry) interface{} { return e.BackendTimeoutSeconds },
+			10,
+			[]string{"invalid i annotation [2O]: must be a whole number"},
+		},
+		{
+			"int below the minimum keeps the default",
+			map[string]string{"i": "0"},
+			intAnnotation("i", 1, math.MaxInt32, func(e *IngressEntry) *int { return &e.BackendTimeoutSeconds }),
+			func(e *IngressEntry) interface{} { return e.BackendTimeoutSeconds },
+			10,
+			[]string{"invalid i annotation [0]: must be at least 1"},
+		},
+		{
+			"int above the maximum keeps the default",
+			map[string]string{"i": "100"},
+			intAnnotation("i", 1, 50, func(e *IngressEntry) *int { return &e.BackendTimeoutSeconds }),
+			func(e *IngressEntry) interface{} { return e.BackendTimeoutSeconds },
+			10,
+			[]string{"invalid i annotation [100]: must be between 1 and 50"},
+		},
+		{
+			"capped int above the maximum uses the maximum",
+			map[string]string{"i": "100"},
+			cappedIntAnnotation("i", 1, 50, func(e *IngressEntry) *int { return &e.BackendTimeoutSeconds }),
+			func(e *IngressEntry) interface{} { return e.BackendTimeoutSeconds },
+			50,
+			[]string{"invalid i annotation [100]: must be between 1 and 50"},
+		},
+		{
+			"capped int below the minimum keeps the default",
+			map[string]string{"i": "-1"},
+			cappedIntAnnotation("i", 1, 50, func(e *IngressEntry) *int { return &e.BackendTimeoutSeconds }),
+			func(e *IngressEntry) interface{} { return e.BackendTimeoutSeconds },
+			10,
+			[]string{"invalid i annotation [-1]: must be between 1 and 50"},
+		},
+		{
+			"valid enum",
+			map[string]string{"e": "internal"},
+			enumAnnotation("e", lbSchemes, func(e *IngressEntry) *string { return &e.LbScheme }),
+			func(e *IngressEntry) interface{} { return e.LbScheme },
+			"internal",
+			nil,
+		},
+		{
+			"invalid enum keeps the default",
+			map[string]string{"e": "public"},
+			enumAnnotation("e", lbSchemes, func(e *IngressEntry) *string { return &e.LbScheme }),
+			func(e *IngressEntry) interface{} { return e.LbScheme },
+			"",
+			[]string{"invalid e annotation [public]: must be one of internal, internet-facing"},
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Printf("test: %s\n", test.description)
+		registry := &AnnotationRegistry{}
+		asserter.NoError(registry.Register(test.handler))
+		entry := IngressEntry{StripPaths: true, BackendTimeoutSeconds: 10}
+
+		annotationErrs := registry.parse(test.annotations, &entry)
+
+		asserter.Equal(test.expected, test.field(&entry), test.description)
+		var errors []string
+		for _, err := range annotationErrs {
+			errors = append(errors, err.Error())
+		}
+		asserter.Equal(test.errors, errors, test.description)
+	}
+}
+
+func TestCappedIntAboveTheMaximumLeavesTheEntryUnchanged(t *testing.T) {
+	asserter := assert.New(t)
+	handler := cappedIntAnnotation("i", 1, 50, func(e *IngressEntry) *int { return &e.BackendTimeoutSeconds })
+	entry := IngressEntry{BackendTimeoutSeconds: 10}
+
+	err := handler.Parse("100", &entry)
+
+	if asserter.IsType(&AnnotationError{}, err) {
+		asserter.Equal("must be between 1 and 50", err.(*AnnotationError).Reason)
+		asserter.Equal("50", err.(*AnnotationError).fallback)
+	}
+	asserter.Equal(10, entry.BackendTimeoutSeconds, "the registry should apply the maximum")
+}
+
+func TestAnnotationRegistryRunsHandlersInOrder(t *testing.T) {
+	asserter := assert.New(t)
+	registry := NewAnnotationRegistry()
+	asserter.NoError(registry.Register(AnnotationHandler{
+		Annotation: "example.com/team",
+		Parse: func(value string, entry *IngressEntry) error {
+			if value == "" {
+				return errors.New("must not be empty")
+			}
+			entry.SetAttribute("example.com/team", value)
+			return nil
+		},
+	}))
+	entry := IngressEntry{}
+
+	annotationErrs := registry.parse(map[string]string{
+		legacyBackendKeepaliveSeconds: "20",
+		backendTimeoutSeconds:         "30",
+		"example.com/team":            "ingress",
+	}, &entry)
+
+	asserter.Empty(annotationErrs)
+	asserter.Equal(30, entry.BackendTimeoutSeconds, "later handlers should override earlier ones")
+	asserter.Equal(map[string]interface{}{"example.com/team": "ingress"}, entry.Attributes)
+
+	annotationErrs = registry.parse(map[string]string{"example.com/team": ""}, &entry)
+
+	if asserter.Len(annotationErrs, 1) {
+		asserter.Equal("invalid example.com/team annotation []: must not be empty", annotationErrs[0].Error())
+		asserter.Equal(usingDefault, annotationErrs[0].fallback)
+	}
+}
+
+func TestAnnotationRegistryRejectsInvalidHandlers(t *testing.T) {
+	asserter := assert.New(t)
+	registry := NewAnnotationRegistry()
+	parse := func(string, *IngressEntry) error { return nil }
+
+	asserter.EqualError(registry.Register(AnnotationHandler{Annotation: stripPathAnnotation, Parse: parse}),
+		"annotation sky.uk/strip-path is already registered")
+	asserter.EqualError(registry.Register(AnnotationHandler{Parse: parse}),
+		"annotation handler has no annotation")
+	asserter.EqualError(registry.Register(AnnotationHandler{Annotation: "example.com/team"}),
+		"annotation handler for example.com/team has no Parse func")
+}
+
+func TestHTTPSRedirectAndHSTSAnnotations(t *testing.T) {
+	entry := IngressEntry{}
+
+	annotationErrs := NewAnnotationRegistry().parse(map[string]string{
+		httpsRedirectAnnotation:         "true",
+		httpsRedirectCodeAnnotation:     "301",
+		hstsMaxAgeSecondsAnnotation:     "0",
+		hstsIncludeSubDomainsAnnotation: "true",
+	}, &entry)
+
+	assert.Empty(t, annotationErrs)
+	assert.True(t, entry.HTTPSRedirect)
+	assert.Equal(t, 301, entry.HTTPSRedirectCode)
+	assert.True(t, entry.HSTS, "a max-age of 0 should still send the header, to clear a previous policy")
+	assert.Equal(t, 0, entry.HSTSMaxAgeSeconds)
+	assert.True(t, entry.HSTSIncludeSubDomains)
+	assert.False(t, entry.HSTSPreload)
+
+	entry = IngressEntry{}
+	annotationErrs = NewAnnotationRegistry().parse(map[string]string{
+		httpsRedirectCodeAnnotation: "302",
+		hstsMaxAgeSecondsAnnotation: "-1",
+	}, &entry)
+
+	var errors []string
+	for _, err := range annotationErrs {
+		errors = append(errors, err.Error())
+	}
+	assert.Equal(t, []string{
+		"invalid sky.uk/https-redirect-code annotation [302]: must be 301 or 308",
+		"invalid sky.uk/hsts-max-age-seconds annotation [-1]: must be at least 0",
+	}, errors)
+	assert.False(t, entry.HSTS)
+}
+
+func TestRateLimitAnnotations(t *testing.T) {
+	entry := IngressEntry{}
+
+	annotationErrs := NewAnnotationRegistry().parse(map[string]string{
+		rateLimitAnnotation:      "600r/m",
+		rateLimitBurstAnnotation: "20",
+		rateLimitKeyAnnotation:   "header:X-Api-Key",
+	}, &entry)
+
+	assert.Empty(t, annotationErrs)
+	assert.Equal(t, "600r/m", entry.RateLimit)
+	assert.Equal(t, 20, entry.RateLimitBurst)
+	assert.Equal(t, "X-Api-Key", entry.RateLimitHeader)
+
+	entry = IngressEntry{}
+	annotationErrs = NewAnnotationRegistry().parse(map[string]string{
+		rateLimitAnnotation:    "10r/h",
+		rateLimitKeyAnnotation: "header:X Api Key",
+	}, &entry)
+
+	var errors []string
+	for _, err := range annotationErrs {
+		errors = append(errors, err.Error())
+	}
+	assert.Equal(t, []string{
+		"invalid sky.uk/rate-limit annotation [10r/h]: must be requests per second or minute, such as 10r/s or 600r/m",
+		"invalid sky.uk/rate-limit-key annotation [header:X Api Key]: must be client-ip or header:<name>",
+	}, errors)
+	assert.Equal(t, "", entry.RateLimit)
+	assert.Equal(t, "", entry.RateLimitHeader)
+}
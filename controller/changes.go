@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"github.com/sky-uk/feed/k8s"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// relevant returns false if the update only has changes which can't affect the ingress entries, such as to
+// services which no ingress references. Updates which don't describe their changes are always relevant.
+func (c *controller) relevant(update interface{}) bool {
+	changes, ok := update.(k8s.Changes)
+	if !ok {
+		return true
+	}
+	for _, change := range changes {
+		if c.relevantChange(change) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *controller) relevantChange(change k8s.Change) bool {
+	switch change.Kind {
+	case k8s.ServiceKind, k8s.EndpointsKind:
+		if c.referencedServices == nil || change.Key == "" {
+			return true
+		}
+		namespace, name, err := cache.SplitMetaNamespaceKey(change.Key)
+		if err != nil {
+			return true
+		}
+		return c.referencedServices[serviceName{namespace: namespace, name: name}]
+	case k8s.SecretKind:
+		return c.referencedSecrets == nil || change.Key == "" || c.referencedSecrets[change.Key]
+	case k8s.NamespaceKind:
+		// Deleting a namespace deletes its ingresses, so only its labels matter, which are used by the selector.
+		return c.namespaceSelector != nil
+	default:
+		return true
+	}
+}
+
+// backendServices returns the services referenced by the ingresses, whether they exist or not.
+func backendServices(ingresses []*networkingv1.Ingress) map[serviceName]bool {
+	services := make(map[serviceName]bool)
+	for _, ingress := range ingresses {
+		for _, rule := range ingress.Spec.Rules {
+			if rule.HTTP == nil {
+				continue
+			}
+			for _, path := range rule.HTTP.Paths {
+				services[serviceName{namespace: ingress.Namespace, name: backendServiceName(path.Backend)}] = true
+			}
+		}
+	}
+	return services
+}
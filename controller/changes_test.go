@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sky-uk/feed/k8s"
+	fake "github.com/sky-uk/feed/util/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+func TestOnlyChangesWhichCanAffectIngressEntriesAreRelevant(t *testing.T) {
+	referenced := backendServices(createDefaultIngresses())
+	referencedKey := ingressNamespace + "/" + ingressSvcName
+
+	var tests = []struct {
+		description       string
+		update            interface{}
+		namespaceSelector *k8s.NamespaceSelector
+		referenced        map[serviceName]bool
+		relevant          bool
+	}{
+		{"update without changes", struct{}{}, nil, referenced, true},
+		{"ingress", k8s.Changes{{Kind: k8s.IngressKind, Key: "other/ingress"}}, nil, referenced, true},
+		{"ingress class", k8s.Changes{{Kind: k8s.IngressClassKind, Key: "main"}}, nil, referenced, true},
+		{"referenced service", k8s.Changes{{Kind: k8s.ServiceKind, Key: referencedKey}}, nil, referenced, true},
+		{"referenced endpoints", k8s.Changes{{Kind: k8s.EndpointsKind, Key: referencedKey}}, nil, referenced, true},
+		{"unreferenced service", k8s.Changes{{Kind: k8s.ServiceKind, Key: ingressNamespace + "/other"}}, nil, referenced, false},
+		{"service in another namespace", k8s.Changes{{Kind: k8s.ServiceKind, Key: "other/" + ingressSvcName}}, nil, referenced, false},
+		{"unreferenced endpoints", k8s.Changes{{Kind: k8s.EndpointsKind, Key: ingressNamespace + "/other"}}, nil, referenced, false},
+		{"service before ingresses are gathered", k8s.Changes{{Kind: k8s.ServiceKind, Key: ingressNamespace + "/other"}}, nil, nil, true},
+		{"service without a key", k8s.Changes{{Kind: k8s.ServiceKind}}, nil, referenced, true},
+		{"namespace without selector", k8s.Changes{{Kind: k8s.NamespaceKind, Key: ingressNamespace}}, nil, referenced, false},
+		{"namespace with selector", k8s.Changes{{Kind: k8s.NamespaceKind, Key: ingressNamespace}},
+			&k8s.NamespaceSelector{LabelName: "team", LabelValue: "theteam"}, referenced, true},
+		{"any relevant change", k8s.Changes{
+			{Kind: k8s.ServiceKind, Key: ingressNamespace + "/other"},
+			{Kind: k8s.ServiceKind, Key: referencedKey},
+		}, nil, referenced, true},
+	}
+
+	for _, test := range tests {
+		c := &controller{namespaceSelector: test.namespaceSelector, referencedServices: test.referenced}
+		assert.Equal(t, test.relevant, c.relevant(test.update), test.description)
+	}
+}
+
+func TestUpdaterIsNotUpdatedForChangesToUnreferencedServices(t *testing.T) {
+	// given
+	asserter := assert.New(t)
+	updater := new(fakeUpdater)
+	client := new(fake.FakeClient)
+	config := defaultConfig()
+	config.KubernetesClient = client
+	config.Updaters = []Updater{updater}
+	controller := New(config)
+
+	ingressWatcher, ingressCh := createFakeWatcher()
+	serviceWatcher, serviceCh := createFakeWatcher()
+	namespaceWatcher, namespaceCh := createFakeWatcher()
+	ingressClassWatcher, _ := createFakeWatcher()
+
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Health").Return(nil)
+	updater.On("Update", mock.Anything).Return(nil)
+	client.On("GetAllIngresses").Return(createDefaultIngresses(), nil)
+	client.On("GetServices").Return(createDefaultServices(), nil)
+	client.On("GetIngressClasses").Return([]*networkingv1.IngressClass{}, nil)
+	client.On("WatchIngresses").Return(ingressWatcher)
+	client.On("WatchServices").Return(serviceWatcher)
+	client.On("WatchNamespaces").Return(namespaceWatcher)
+	client.On("WatchIngressClasses").Return(ingressClassWatcher)
+	asserter.NoError(controller.Start())
+
+	// when
+	ingressCh <- k8s.Changes{{Kind: k8s.IngressKind, Key: ingressNamespace + "/" + ingressName}}
+	time.Sleep(smallWaitTime)
+	serviceCh <- k8s.Changes{{Kind: k8s.ServiceKind, Key: ingressNamespace + "/unrelated"}}
+	namespaceCh <- k8s.Changes{{Kind: k8s.NamespaceKind, Key: "unrelated"}}
+	time.Sleep(smallWaitTime)
+
+	// then
+	updater.AssertNumberOfCalls(t, "Update", 1)
+
+	// and referenced services still update
+	serviceCh <- k8s.Changes{{Kind: k8s.ServiceKind, Key: ingressNamespace + "/" + ingressSvcName}}
+	time.Sleep(smallWaitTime)
+	updater.AssertNumberOfCalls(t, "Update", 2)
+
+	// cleanup
+	asserter.NoError(controller.Stop())
+}
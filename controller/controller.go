@@ -7,16 +7,21 @@ package controller
 import (
 	"errors"
 	"fmt"
+	"os"
 	"runtime/debug"
-	"strconv"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/sky-uk/feed/k8s"
 	"github.com/sky-uk/feed/util"
+	"github.com/sky-uk/feed/util/metrics"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/record"
 )
 
 // Deprecated: retained to maintain backwards compatibility.
@@ -38,12 +43,50 @@ const (
 	maxAllowedProxyBufferSize   = 32
 	maxAllowedProxyBufferBlocks = 8
 
+	// proxy directly to the ready pods of the backend service instead of its cluster IP
+	routeToEndpointsAnnotation = "sky.uk/route-to-endpoints"
+
 	// sets Nginx (http://nginx.org/en/docs/http/ngx_http_upstream_module.html#max_conns)
 	backendMaxConnections = "sky.uk/backend-max-connections"
 
+	// chooses the named TLS profile of the https port
+	tlsProfileAnnotation = "sky.uk/tls-profile"
+
+	// redirects plain http requests to https with a 301 or 308
+	httpsRedirectAnnotation     = "sky.uk/https-redirect"
+	httpsRedirectCodeAnnotation = "sky.uk/https-redirect-code"
+
+	// adds a Strict-Transport-Security header with the max-age to https responses
+	hstsMaxAgeSecondsAnnotation     = "sky.uk/hsts-max-age-seconds"
+	hstsIncludeSubDomainsAnnotation = "sky.uk/hsts-include-subdomains"
+	hstsPreloadAnnotation           = "sky.uk/hsts-preload"
+
+	// limits the request rate of each client of the ingress, identified by their IP or a header
+	rateLimitAnnotation      = "sky.uk/rate-limit"
+	rateLimitBurstAnnotation = "sky.uk/rate-limit-burst"
+	rateLimitKeyAnnotation   = "sky.uk/rate-limit-key"
+
 	ingressClassAnnotation = "kubernetes.io/ingress.class"
+
+	lbSchemeInternal       = "internal"
+	lbSchemeInternetFacing = "internet-facing"
+
+	// marks the IngressClass used for ingresses that don't request a class
+	defaultIngressClassAnnotation = "ingressclass.kubernetes.io/is-default-class"
 )
 
+var lbSchemes = []string{lbSchemeInternal, lbSchemeInternetFacing}
+
+// IngressClassControllerPrefix is combined with the name of a feed instance to form the spec.controller
+// value of the IngressClass resources handled by that instance.
+const IngressClassControllerPrefix = "sky.uk/feed/"
+
+// IngressClassController returns the spec.controller value of IngressClass resources handled by the
+// feed instance with the given name.
+func IngressClassController(name string) string {
+	return IngressClassControllerPrefix + name
+}
+
 // Controller operates on ingress resources, listening for updates and notifying its Updaters.
 type Controller interface {
 	// Run the controller, returning immediately after it starts or an error occurs.
@@ -52,6 +95,11 @@ type Controller interface {
 	Stop() error
 	// Healthy returns true for a healthy controller, false for unhealthy.
 	Health() error
+	// HealthReport describes the health of the controller and each of its updaters.
+	HealthReport() HealthReport
+	// OverrideRemovalThreshold allows the next update to remove any number of entries, such as when many
+	// ingresses are deleted on purpose, and triggers it.
+	OverrideRemovalThreshold()
 }
 
 type controller struct {
@@ -64,19 +112,42 @@ type controller struct {
 	defaultBackendMaxConnections int
 	defaultProxyBufferSize       int
 	defaultProxyBufferBlocks     int
+	defaultRouteToEndpoints      bool
+	strictAnnotations            bool
+	annotations                  *AnnotationRegistry
+	watchEndpoints               bool
+	watchSecrets                 bool
 	watcher                      k8s.Watcher
 	doneCh                       chan struct{}
 	watcherDone                  sync.WaitGroup
 	started                      bool
-	updatesHealth                util.SafeError
+	updatesHealth                *updatesHealth
 	sync.Mutex
 	name                      string
 	includeClasslessIngresses bool
 	namespaceSelector         *k8s.NamespaceSelector
+	ingressSelector           labels.Selector
+	events                    *ingressEvents
+	// entries of the last successful update of each DeltaUpdater, by index in updaters
+	lastEntries  map[int]IngressEntries
+	snapshotFile string
+	lastSnapshot IngressEntries
+	// degraded is set while using entries from the snapshot, until ingresses are synced
+	degraded   util.SafeBool
+	removals   *removalGuard
+	overrideCh chan struct{}
+	// services referenced by the ingresses of the last update, or nil if ingresses couldn't be gathered
+	referencedServices map[serviceName]bool
+	// namespace/name keys of the TLS secrets referenced by the ingresses of the last update
+	referencedSecrets map[string]bool
+	limiter           *updateLimiter
+	// names of the TLS profiles ingresses can choose, or nil to allow any
+	tlsProfiles []string
 }
 
 // Config for creating a new ingress controller.
 type Config struct {
+	// KubernetesClient is stopped when the controller stops, after its updaters.
 	KubernetesClient             k8s.Client
 	Updaters                     []Updater
 	DefaultAllow                 string
@@ -86,13 +157,62 @@ type Config struct {
 	DefaultBackendMaxConnections int
 	DefaultProxyBufferSize       int
 	DefaultProxyBufferBlocks     int
+	DefaultRouteToEndpoints      bool
+	WatchEndpoints               bool
+	StrictAnnotations            bool
 	Name                         string
 	IncludeClasslessIngresses    bool
 	NamespaceSelector            *k8s.NamespaceSelector
+	// WatchSecrets reads the certificate of each host from the kubernetes.io/tls Secret its ingress lists it under
+	// in spec.tls, into IngressEntry.TLSCertificate.
+	WatchSecrets bool
+	// TLSProfiles are the names ingresses can choose with the sky.uk/tls-profile annotation. Other names are
+	// invalid annotations. Any name is allowed if nil.
+	TLSProfiles []string
+	// IngressSelector only considers ingresses whose own labels match, so ingresses can be sharded between
+	// feed instances. Optional.
+	IngressSelector labels.Selector
+	// EventRecorder records events on ingresses that are skipped or have invalid annotations. Optional.
+	EventRecorder record.EventRecorder
+	// Annotations parses the annotations of ingresses into their entries. Defaults to NewAnnotationRegistry().
+	Annotations *AnnotationRegistry
+	// UpdateRetryInitialBackoff is how long to wait before retrying a failed updater. It doubles with each
+	// consecutive failure, up to UpdateRetryMaxBackoff. Defaults to 1 second and 5 minutes.
+	UpdateRetryInitialBackoff time.Duration
+	UpdateRetryMaxBackoff     time.Duration
+	// SnapshotFile is where the last entries applied by every updater are saved. If set, updaters are updated
+	// with the snapshot on start, so they don't depend on the API server being available. Optional.
+	SnapshotFile string
+	// MaxRemovedEntries refuses updates which remove more than this many entries of the previous update, until
+	// the threshold is overridden. Disabled if 0.
+	MaxRemovedEntries int
+	// MaxRemovedEntriesPercent refuses updates which remove more than this percentage of the entries of the
+	// previous update, until the threshold is overridden. Disabled if 0.
+	MaxRemovedEntriesPercent int
+	// UpdateMinInterval coalesces watcher updates, so a storm of changes causes few recomputes of the ingress
+	// entries. Once UpdateBurst updates have been applied immediately, updates are delayed until none has arrived
+	// for UpdateMinInterval, or for UpdateMaxDelay since the first delayed update. A further update may be applied
+	// immediately for every UpdateMinInterval. Disabled if 0. UpdateMaxDelay defaults to 10 seconds, and
+	// UpdateBurst to 1.
+	UpdateMinInterval time.Duration
+	UpdateMaxDelay    time.Duration
+	UpdateBurst       int
+	// MetricsSubsystem is the prometheus subsystem of the controller metrics. Defaults to the ingress subsystem.
+	MetricsSubsystem string
 }
 
 // New creates an ingress controller.
 func New(conf Config) Controller {
+	annotations := conf.Annotations
+	if annotations == nil {
+		annotations = NewAnnotationRegistry()
+	}
+	subsystem := conf.MetricsSubsystem
+	if subsystem == "" {
+		subsystem = metrics.PrometheusIngressSubsystem
+	}
+	initMetrics(subsystem)
+
 	return &controller{
 		client:                       conf.KubernetesClient,
 		updaters:                     conf.Updaters,
@@ -103,10 +223,24 @@ func New(conf Config) Controller {
 		defaultBackendMaxConnections: conf.DefaultBackendMaxConnections,
 		defaultProxyBufferSize:       conf.DefaultProxyBufferSize,
 		defaultProxyBufferBlocks:     conf.DefaultProxyBufferBlocks,
+		defaultRouteToEndpoints:      conf.DefaultRouteToEndpoints,
+		strictAnnotations:            conf.StrictAnnotations,
+		annotations:                  annotations,
+		watchEndpoints:               conf.WatchEndpoints || conf.DefaultRouteToEndpoints,
+		watchSecrets:                 conf.WatchSecrets,
+		tlsProfiles:                  conf.TLSProfiles,
 		doneCh:                       make(chan struct{}),
 		name:                         conf.Name,
 		includeClasslessIngresses:    conf.IncludeClasslessIngresses,
 		namespaceSelector:            conf.NamespaceSelector,
+		ingressSelector:              conf.IngressSelector,
+		events:                       newIngressEvents(conf.EventRecorder),
+		lastEntries:                  make(map[int]IngressEntries),
+		snapshotFile:                 conf.SnapshotFile,
+		updatesHealth:                newUpdatesHealth(conf.Updaters, conf.UpdateRetryInitialBackoff, conf.UpdateRetryMaxBackoff),
+		removals:                     &removalGuard{maxRemoved: conf.MaxRemovedEntries, maxRemovedPercent: conf.MaxRemovedEntriesPercent},
+		overrideCh:                   make(chan struct{}, 1),
+		limiter:                      newUpdateLimiter(conf.UpdateMinInterval, conf.UpdateMaxDelay, conf.UpdateBurst),
 	}
 }
 
@@ -146,39 +280,144 @@ func (c *controller) watchForUpdates() {
 	ingressWatcher := c.client.WatchIngresses()
 	serviceWatcher := c.client.WatchServices()
 	namespaceWatcher := c.client.WatchNamespaces()
-	c.watcher = k8s.CombineWatchers(ingressWatcher, serviceWatcher, namespaceWatcher)
+	ingressClassWatcher := c.client.WatchIngressClasses()
+	watchers := []k8s.Watcher{ingressWatcher, serviceWatcher, namespaceWatcher, ingressClassWatcher}
+	if c.watchEndpoints {
+		watchers = append(watchers, c.client.WatchEndpoints())
+	}
+	if c.watchSecrets {
+		watchers = append(watchers, c.client.WatchSecrets())
+	}
+	c.watcher = k8s.CombineWatchersUntil(c.doneCh, watchers...)
 	c.watcherDone.Add(1)
 	go c.handleUpdates()
 }
 
 func (c *controller) handleUpdates() {
+	defer c.watcherDone.Done()
 	defer log.Debug("Controller stopped watching for updates")
 
+	c.applySnapshot()
+
+	var retryTimer, pendingTimer *time.Timer
+	var retryCh, pendingCh <-chan time.Time
 	for {
+		stopTimer(retryTimer)
+		stopTimer(pendingTimer)
+		retryTimer, retryCh = nil, nil
+		if delay, ok := c.updatesHealth.nextRetry(time.Now()); ok {
+			log.Debugf("Retrying failed updaters in %v", delay)
+			retryTimer = time.NewTimer(delay)
+			retryCh = retryTimer.C
+		}
+		pendingTimer, pendingCh = nil, nil
+		if delay, ok := c.limiter.due(time.Now()); ok {
+			pendingTimer = time.NewTimer(delay)
+			pendingCh = pendingTimer.C
+		}
+
 		select {
-		case <-c.watcher.Updates():
-			log.Info("Received update on watcher")
-			if err := c.updateIngresses(); err != nil {
-				c.updatesHealth.Set(err)
-				log.Errorf("Unable to update ingresses: %v", err)
-			} else {
-				c.updatesHealth.Set(nil)
+		case update := <-c.watcher.Updates():
+			if !c.relevant(update) {
+				log.Debugf("Ignoring update on watcher, as no ingress depends on %v", update)
+				ignoredWatchEventsCount.Inc()
+				continue
 			}
+			watchEventsCount.Inc()
+			if c.limiter.pending() {
+				coalescedWatchEventsCount.Inc()
+			}
+			if !c.limiter.received(time.Now()) {
+				log.Debug("Received update on watcher, delaying it to coalesce with later updates")
+				continue
+			}
+			log.Info("Received update on watcher")
+			c.updateIngresses(false)
+		case <-pendingCh:
+			log.Info("Applying coalesced updates on watcher")
+			c.limiter.applied(time.Now())
+			c.updateIngresses(false)
+		case <-c.overrideCh:
+			log.Info("Removal threshold overridden")
+			c.updateIngresses(false)
+		case <-retryCh:
+			log.Info("Retrying failed updaters")
+			c.updateIngresses(true)
 		case <-c.doneCh:
+			stopTimer(retryTimer)
+			stopTimer(pendingTimer)
 			return
 		}
 	}
 }
 
-func (c *controller) updateIngresses() (err error) {
+func stopTimer(timer *time.Timer) {
+	if timer != nil {
+		timer.Stop()
+	}
+}
+
+// applySnapshot updates with the entries of the last known good snapshot, so updaters such as nginx can start
+// before ingresses are synced, which may never happen if the API server is unavailable.
+func (c *controller) applySnapshot() {
+	if c.snapshotFile == "" {
+		return
+	}
+
+	entries, err := loadSnapshot(c.snapshotFile)
+	if os.IsNotExist(err) {
+		log.Infof("No snapshot of ingress entries found at %s", c.snapshotFile)
+		return
+	}
+	if err != nil {
+		log.Warnf("Unable to load snapshot of ingress entries from %s: %v", c.snapshotFile, err)
+		return
+	}
+
+	log.Infof("Updating with %d entries from snapshot %s until ingresses are synced", len(entries), c.snapshotFile)
+	c.degraded.Set(true)
+	c.lastSnapshot = entries
+	c.removals.previous = entries
+	for i, u := range c.updaters {
+		err := c.update(i, u, entries)
+		c.updatesHealth.updated(i, err, time.Now())
+		if err != nil {
+			log.Errorf("Unable to update %v from snapshot: %v", u, err)
+		}
+	}
+}
+
+// saveSnapshot saves entries which every updater has applied, if they changed since the last snapshot.
+func (c *controller) saveSnapshot(entries IngressEntries) {
+	if c.snapshotFile == "" || c.updatesHealth.get() != nil {
+		return
+	}
+	if c.lastSnapshot != nil && diffIngressEntries(c.lastSnapshot, entries).Empty() {
+		return
+	}
+
+	saved, err := saveSnapshot(c.snapshotFile, entries)
+	if err != nil {
+		log.Warnf("Unable to save snapshot of ingress entries to %s: %v", c.snapshotFile, err)
+		return
+	}
+	log.Debugf("Saved snapshot of %d of %d ingress entries to %s", saved, len(entries), c.snapshotFile)
+	c.lastSnapshot = entries
+}
+
+// ingressEntries combines ingresses and their services into the entries passed to updaters.
+func (c *controller) ingressEntries() (_ IngressEntries, err error) {
 	defer func() {
 		if value := recover(); value != nil {
 			err = fmt.Errorf("unexpected error: %v: %v", value, string(debug.Stack()))
 		}
 	}()
 
+	c.referencedServices = nil
+	c.referencedSecrets = nil
+
 	// Get ingresses
-	var ingresses []*v1beta1.Ingress
+	var ingresses []*networkingv1.Ingress
 
 	if c.namespaceSelector == nil {
 		ingresses, err = c.client.GetAllIngresses()
@@ -189,177 +428,378 @@ func (c *controller) updateIngresses() (err error) {
 	log.Debugf("Found %d ingresses", len(ingresses))
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	ingresses = c.selectedIngresses(ingresses)
+	c.referencedServices = backendServices(ingresses)
+	c.referencedSecrets = tlsSecretKeys(ingresses)
+
 	if len(ingresses) == 0 {
-		return errors.New("found 0 ingresses")
+		return nil, errors.New("found 0 ingresses")
 	}
 
 	// Get services
 	services, err := c.client.GetServices()
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	log.Debugf("Found %d services", len(services))
 
 	if len(services) == 0 {
-		return errors.New("found 0 services")
+		return nil, errors.New("found 0 services")
+	}
+
+	// Get ingress classes
+	ingressClasses, err := c.client.GetIngressClasses()
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Found %d ingress classes", len(ingressClasses))
+
+	// Get endpoints
+	var endpointsMap map[serviceName]*v1.Endpoints
+	if c.watchEndpoints {
+		endpoints, err := c.client.GetEndpoints()
+
+		if err != nil {
+			return nil, err
+		}
+
+		log.Debugf("Found %d endpoints", len(endpoints))
+		endpointsMap = serviceNamesToEndpoints(endpoints)
+	}
+
+	// Get TLS secrets
+	var secretsMap map[string]*v1.Secret
+	if c.watchSecrets {
+		secrets, err := c.client.GetSecrets()
+
+		if err != nil {
+			return nil, err
+		}
+
+		log.Debugf("Found %d TLS secrets", len(secrets))
+		secretsMap = tlsSecretsByKey(secrets)
 	}
 
 	log.Infof("Found %d ingresses and %d services", len(ingresses), len(services))
+	ownedClasses, ownsDefaultClass := c.ownedIngressClasses(ingressClasses)
 
 	// Combine ingresses and services to create Ingress Entries
-	serviceMap := serviceNamesToClusterIPs(services)
+	serviceMap := serviceNamesToServices(services)
 	var skipped []string
+	skip := func(ingress *networkingv1.Ingress, eventType, reason, message string) {
+		skipped = append(skipped, fmt.Sprintf("%s/%s (%s)", ingress.Namespace, ingress.Name, message))
+		c.events.record(ingress, eventType, reason, message)
+	}
 	var entries []IngressEntry
+	otherClasses := 0
 	for _, ingress := range ingresses {
+		// Ingresses of other classes belong to other controllers, so they're only counted in the log, without
+		// recording events.
+		if !c.ingressClassSupported(ingress, ownedClasses, ownsDefaultClass) {
+			otherClasses++
+			log.Debugf("Ignoring ingress %s/%s, as it requests class [%s]; this instance is [%s]",
+				ingress.Namespace, ingress.Name, requestedIngressClass(ingress), c.name)
+			continue
+		}
+
 		for _, rule := range ingress.Spec.Rules {
 
 			if rule.HTTP != nil {
 				for _, path := range rule.HTTP.Paths {
 
-					serviceName := serviceName{namespace: ingress.Namespace, name: path.Backend.ServiceName}
+					serviceName := serviceName{namespace: ingress.Namespace, name: backendServiceName(path.Backend)}
 
-					if address := serviceMap[serviceName]; address == "" {
-						skipped = append(skipped, fmt.Sprintf("%s/%s (service doesn't exist)", ingress.Namespace, ingress.Name))
-					} else if !c.ingressClassSupported(ingress) {
-						skipped = append(skipped, fmt.Sprintf("%s/%s (ingress requests class [%s]; this instance is [%s])",
-							ingress.Namespace, ingress.Name, ingress.Annotations[ingressClassAnnotation], c.name))
+					if service, ok := serviceMap[serviceName]; !ok {
+						skip(ingress, v1.EventTypeWarning, serviceNotFoundReason,
+							fmt.Sprintf("service %s doesn't exist", serviceName.name))
 					} else {
 						entry := IngressEntry{
-							Namespace:      ingress.Namespace,
-							Name:           ingress.Name,
-							Host:           rule.Host,
-							Path:           path.Path,
-							ServiceAddress: address,
-							ServicePort:    int32(path.Backend.ServicePort.IntValue()),
-							Allow:          c.defaultAllow,
-							StripPaths:     c.defaultStripPath,
-							ExactPath:      c.defaultExactPath, BackendTimeoutSeconds: c.defaultBackendTimeout,
+							Namespace:        ingress.Namespace,
+							Name:             ingress.Name,
+							Host:             rule.Host,
+							Path:             path.Path,
+							ServiceAddress:   service.Spec.ClusterIP,
+							ServiceName:      serviceName.name,
+							ServicePort:      backendServicePort(path.Backend, service),
+							RouteToEndpoints: c.defaultRouteToEndpoints,
+							Allow:            c.defaultAllow,
+							StripPaths:       c.defaultStripPath,
+							ExactPath:        c.defaultExactPath, BackendTimeoutSeconds: c.defaultBackendTimeout,
 							BackendMaxConnections: c.defaultBackendMaxConnections,
 							ProxyBufferSize:       c.defaultProxyBufferSize,
 							ProxyBufferBlocks:     c.defaultProxyBufferBlocks,
 							CreationTimestamp:     ingress.CreationTimestamp.Time,
 							Ingress:               ingress,
-							IngressClass:          ingress.Annotations[ingressClassAnnotation],
+							IngressClass:          requestedIngressClass(ingress),
 						}
 
 						log.Debugf("Found ingress to update: %s/%s", ingress.Namespace, ingress.Name)
 
-						if lbScheme, ok := ingress.Annotations[frontendSchemeAnnotation]; ok {
-							entry.LbScheme = lbScheme
-						} else if legacyElbScheme, ok := ingress.Annotations[legacyFrontendElbSchemeAnnotation]; ok {
-							entry.LbScheme = legacyElbScheme
-						}
-
-						if allow, ok := ingress.Annotations[ingressAllowAnnotation]; ok {
-							if allow == "" {
-								entry.Allow = []string{}
-							} else {
-								entry.Allow = strings.Split(allow, ",")
-							}
+						annotationErrs := c.annotations.parse(ingress.Annotations, &entry)
+						if err := c.validateTLSProfile(&entry); err != nil {
+							annotationErrs = append(annotationErrs, err)
 						}
 
-						if stripPath, ok := ingress.Annotations[stripPathAnnotation]; ok {
-							if stripPath == "true" {
-								entry.StripPaths = true
-							} else if stripPath == "false" {
-								entry.StripPaths = false
-							} else {
-								log.Warnf("Ingress %s/%s has an invalid strip path annotation [%s]. Using default",
-									ingress.Namespace, ingress.Name, stripPath)
-							}
-						}
-
-						if exactPath, ok := ingress.Annotations[exactPathAnnotation]; ok {
-							if exactPath == "true" {
+						// An explicit Exact or Prefix path type takes precedence over the exact path annotation.
+						// ImplementationSpecific paths keep the annotation and default behaviour.
+						if path.PathType != nil {
+							switch *path.PathType {
+							case networkingv1.PathTypeExact:
 								entry.ExactPath = true
-							} else if exactPath == "false" {
+							case networkingv1.PathTypePrefix:
 								entry.ExactPath = false
-							} else {
-								log.Warnf("Ingress %s/%s has an invalid exact path annotation [%s]. Using default",
-									ingress.Namespace, ingress.Name, exactPath)
 							}
 						}
 
-						if backendKeepAlive, ok := ingress.Annotations[legacyBackendKeepaliveSeconds]; ok {
-							tmp, _ := strconv.Atoi(backendKeepAlive)
-							entry.BackendTimeoutSeconds = tmp
+						if len(annotationErrs) > 0 && c.strictAnnotations {
+							skip(ingress, v1.EventTypeWarning, invalidAnnotationReason,
+								fmt.Sprintf("%s%s: %s", entry.Host, entry.Path, joinAnnotationErrors(annotationErrs)))
+							continue
 						}
-
-						if timeout, ok := ingress.Annotations[backendTimeoutSeconds]; ok {
-							tmp, _ := strconv.Atoi(timeout)
-							entry.BackendTimeoutSeconds = tmp
+						for _, annotationErr := range annotationErrs {
+							c.invalidAnnotation(ingress, annotationErr)
 						}
 
-						if maxConnections, ok := ingress.Annotations[backendMaxConnections]; ok {
-							tmp, _ := strconv.Atoi(maxConnections)
-							entry.BackendMaxConnections = tmp
-						}
-
-						if proxyBufferSizeString, ok := ingress.Annotations[proxyBufferSizeAnnotation]; ok {
-							tmp, _ := strconv.Atoi(proxyBufferSizeString)
-							entry.ProxyBufferSize = tmp
-							if tmp > maxAllowedProxyBufferSize {
-								log.Warnf("ProxyBufferSize value %dk exceeds the max permissible value %dk. Using %dk.", tmp, maxAllowedProxyBufferSize, maxAllowedProxyBufferSize)
-								entry.ProxyBufferSize = maxAllowedProxyBufferSize
+						if entry.RouteToEndpoints {
+							if c.watchEndpoints {
+								if portName, ok := backendServicePortName(path.Backend, service); ok {
+									entry.Endpoints = serviceEndpoints(endpointsMap[serviceName], portName)
+								}
+								// A named port missing from the service spec can still be resolved from the endpoints.
+								if entry.ServicePort == 0 && len(entry.Endpoints) > 0 {
+									entry.ServicePort = entry.Endpoints[0].Port
+								}
+							} else {
+								log.Warnf("Ingress %s/%s requests routing to endpoints, but endpoints aren't being watched. Using the service address",
+									ingress.Namespace, ingress.Name)
+								entry.RouteToEndpoints = false
 							}
 						}
 
-						if proxyBufferBlocksString, ok := ingress.Annotations[proxyBufferBlocksAnnotation]; ok {
-							tmp, _ := strconv.Atoi(proxyBufferBlocksString)
-							entry.ProxyBufferBlocks = tmp
-							if tmp > maxAllowedProxyBufferBlocks {
-								log.Warnf("ProxyBufferBlocks value %d exceeds the max permissible value %d. Using %d", tmp, maxAllowedProxyBufferBlocks, maxAllowedProxyBufferBlocks)
-								entry.ProxyBufferBlocks = maxAllowedProxyBufferBlocks
-							}
+						if c.watchSecrets {
+							entry.TLSCertificate = c.tlsCertificate(ingress, entry.Host, secretsMap)
 						}
 
 						if err := entry.validate(); err == nil {
 							entries = append(entries, entry)
 						} else {
-							skipped = append(skipped, fmt.Sprintf("%s (%v)", entry.NamespaceName(), err))
+							skip(ingress, v1.EventTypeWarning, invalidIngressReason,
+								fmt.Sprintf("%s%s: %v", entry.Host, entry.Path, err))
 						}
 					}
 				}
 
 			} else {
-				skipped = append(skipped, fmt.Sprintf("%s/%s (HTTP key doesn't exist in this ingress definition)", ingress.Namespace, ingress.Name))
+				skip(ingress, v1.EventTypeWarning, missingHTTPRuleReason, "HTTP key doesn't exist in this ingress definition")
 			}
 		}
 	}
 
-	log.Infof("Updating with %d entries from %d total ingresses (skipped %d)", len(entries), len(ingresses), len(skipped))
+	c.events.expire()
+
+	log.Infof("Updating with %d entries from %d total ingresses (skipped %d, ignored %d of other classes)",
+		len(entries), len(ingresses), len(skipped), otherClasses)
 	if len(skipped) > 0 {
 		for _, msg := range skipped {
 			log.Debugf("Skipped %s", msg)
 		}
 	}
 
-	for _, u := range c.updaters {
-		log.Debugf("Calling updater %v", u)
-		if err := u.Update(entries); err != nil {
-			return err
+	return entries, nil
+}
+
+// selectedIngresses returns the ingresses whose labels match the ingress selector, if there is one.
+func (c *controller) selectedIngresses(ingresses []*networkingv1.Ingress) []*networkingv1.Ingress {
+	if c.ingressSelector == nil {
+		return ingresses
+	}
+
+	var selected []*networkingv1.Ingress
+	for _, ingress := range ingresses {
+		if c.ingressSelector.Matches(labels.Set(ingress.Labels)) {
+			selected = append(selected, ingress)
+		}
+	}
+	log.Debugf("Found %d of %d ingresses that match the selector %v", len(selected), len(ingresses), c.ingressSelector)
+	return selected
+}
+
+// updateIngresses calls every updater with the latest ingress entries, or only the failed updaters which
+// are due a retry if retrying. Each updater is called even if another fails.
+func (c *controller) updateIngresses(retrying bool) {
+	entries, err := c.ingressEntries()
+	c.updatesHealth.setEntriesErr(err)
+	if err != nil {
+		log.Errorf("Unable to update ingresses: %v", err)
+		if retrying {
+			c.updatesHealth.postponeRetries(time.Now())
+		}
+		return
+	}
+	if err := c.removals.check(entries); err != nil {
+		log.Errorf("Not updating ingresses: %v. Check the ingresses are visible to feed, "+
+			"or override the threshold if they were deleted on purpose", err)
+		c.updatesHealth.setEntriesErr(err)
+		if retrying {
+			c.updatesHealth.postponeRetries(time.Now())
+		}
+		return
+	}
+	if c.degraded.Get() {
+		log.Info("Ingresses are synced, no longer using the snapshot")
+		c.degraded.Set(false)
+	}
+
+	for i, u := range c.updaters {
+		if retrying && !c.updatesHealth.retryDue(i, time.Now()) {
+			continue
+		}
+		err := c.update(i, u, entries)
+		c.updatesHealth.updated(i, err, time.Now())
+		if err != nil {
+			log.Errorf("Unable to update %v: %v", u, err)
 		}
 	}
 
+	c.saveSnapshot(entries)
+}
+
+// update calls the updater at index i of the updaters. DeltaUpdaters are only called if entries changed since
+// their last successful update.
+func (c *controller) update(i int, u Updater, entries IngressEntries) (err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			err = fmt.Errorf("unexpected error: %v: %v", value, string(debug.Stack()))
+		}
+	}()
+
+	deltaUpdater, ok := u.(DeltaUpdater)
+	if !ok {
+		log.Debugf("Calling updater %v", u)
+		return u.Update(entries)
+	}
+
+	previous, updated := c.lastEntries[i]
+	delta := diffIngressEntries(previous, entries)
+	if updated && delta.Empty() {
+		log.Debugf("Not calling updater %v, as no entries changed", u)
+		return nil
+	}
+
+	log.Debugf("Calling updater %v with %v", u, delta)
+	if err := deltaUpdater.UpdateDelta(entries, delta); err != nil {
+		return err
+	}
+	c.lastEntries[i] = entries
 	return nil
 }
 
-func (c *controller) ingressClassSupported(ingress *v1beta1.Ingress) bool {
+// invalidAnnotation logs and records an event for an annotation value that was replaced.
+func (c *controller) invalidAnnotation(ingress *networkingv1.Ingress, err *AnnotationError) {
+	message := fmt.Sprintf("%v, using %s", err, err.fallback)
+	log.Warnf("Ingress %s/%s has an %s", ingress.Namespace, ingress.Name, message)
+	c.events.record(ingress, v1.EventTypeWarning, invalidAnnotationReason, message)
+}
+
+func joinAnnotationErrors(errs []*AnnotationError) string {
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ownedIngressClasses returns the names of the IngressClass resources handled by this instance,
+// and whether one of them is marked as the cluster default.
+func (c *controller) ownedIngressClasses(ingressClasses []*networkingv1.IngressClass) (map[string]bool, bool) {
+	owned := make(map[string]bool)
+	ownsDefault := false
+
+	if c.name == "" {
+		return owned, ownsDefault
+	}
+
+	for _, ingressClass := range ingressClasses {
+		if ingressClass.Spec.Controller != IngressClassController(c.name) {
+			continue
+		}
+		owned[ingressClass.Name] = true
+		if ingressClass.Annotations[defaultIngressClassAnnotation] == "true" {
+			ownsDefault = true
+		}
+	}
+
+	return owned, ownsDefault
+}
+
+func (c *controller) ingressClassSupported(ingress *networkingv1.Ingress, ownedClasses map[string]bool, ownsDefaultClass bool) bool {
 
-	isValid := false
+	if ingress.Spec.IngressClassName != nil {
+		return ownedClasses[*ingress.Spec.IngressClassName]
+	}
 
 	if ingressClass, ok := ingress.Annotations[ingressClassAnnotation]; ok {
-		isValid = ingressClass == c.name
-	} else {
-		isValid = c.includeClasslessIngresses
+		return ingressClass == c.name
+	}
+
+	return ownsDefaultClass || c.includeClasslessIngresses
+}
+
+// requestedIngressClass returns the class requested by the ingress, preferring spec.ingressClassName
+// over the legacy annotation.
+func requestedIngressClass(ingress *networkingv1.Ingress) string {
+	if ingress.Spec.IngressClassName != nil {
+		return *ingress.Spec.IngressClassName
+	}
+	return ingress.Annotations[ingressClassAnnotation]
+}
+
+func backendServiceName(backend networkingv1.IngressBackend) string {
+	if backend.Service == nil {
+		return ""
+	}
+	return backend.Service.Name
+}
+
+// backendServicePort returns the port number of the backend, looking up named ports in the service spec.
+// It returns 0 if the port can't be resolved.
+func backendServicePort(backend networkingv1.IngressBackend, service *v1.Service) int32 {
+	if backend.Service == nil {
+		return 0
+	}
+	if backend.Service.Port.Name == "" {
+		return backend.Service.Port.Number
+	}
+	for _, port := range service.Spec.Ports {
+		if port.Name == backend.Service.Port.Name {
+			return port.Port
+		}
 	}
+	return 0
+}
 
-	return isValid
+// backendServicePortName returns the name of the service port used by the backend. Endpoint ports are
+// matched to service ports by name, which is empty for single port services.
+func backendServicePortName(backend networkingv1.IngressBackend, service *v1.Service) (string, bool) {
+	if backend.Service == nil {
+		return "", false
+	}
+	if backend.Service.Port.Name != "" {
+		return backend.Service.Port.Name, true
+	}
+	for _, port := range service.Spec.Ports {
+		if port.Port == backend.Service.Port.Number {
+			return port.Name, true
+		}
+	}
+	return "", false
 }
 
 type serviceName struct {
@@ -367,17 +807,57 @@ type serviceName struct {
 	name      string
 }
 
-func serviceNamesToClusterIPs(services []*v1.Service) map[serviceName]string {
-	m := make(map[serviceName]string)
+func serviceNamesToServices(services []*v1.Service) map[serviceName]*v1.Service {
+	m := make(map[serviceName]*v1.Service)
 
 	for _, svc := range services {
 		name := serviceName{namespace: svc.Namespace, name: svc.Name}
-		m[name] = svc.Spec.ClusterIP
+		m[name] = svc
 	}
 
 	return m
 }
 
+func serviceNamesToEndpoints(endpoints []*v1.Endpoints) map[serviceName]*v1.Endpoints {
+	m := make(map[serviceName]*v1.Endpoints)
+
+	for _, ep := range endpoints {
+		name := serviceName{namespace: ep.Namespace, name: ep.Name}
+		m[name] = ep
+	}
+
+	return m
+}
+
+// serviceEndpoints returns the ready pod addresses for the named endpoint port, sorted so that
+// the generated config is stable between updates.
+func serviceEndpoints(endpoints *v1.Endpoints, portName string) []Endpoint {
+	if endpoints == nil {
+		return nil
+	}
+
+	var result []Endpoint
+	for _, subset := range endpoints.Subsets {
+		for _, port := range subset.Ports {
+			if port.Name != portName {
+				continue
+			}
+			for _, address := range subset.Addresses {
+				result = append(result, Endpoint{Address: address.IP, Port: port.Port})
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Address != result[j].Address {
+			return result[i].Address < result[j].Address
+		}
+		return result[i].Port < result[j].Port
+	})
+
+	return result
+}
+
 func (c *controller) Stop() error {
 	c.Lock()
 	defer c.Unlock()
@@ -388,6 +868,7 @@ func (c *controller) Stop() error {
 
 	log.Info("Stopping controller")
 	close(c.doneCh)
+	c.watcherDone.Wait()
 
 	for i := range c.updaters {
 		u := c.updaters[len(c.updaters)-1-i]
@@ -396,11 +877,21 @@ func (c *controller) Stop() error {
 		}
 	}
 
+	c.client.Stop()
+
 	c.started = false
 	log.Info("Controller has stopped")
 	return nil
 }
 
+func (c *controller) OverrideRemovalThreshold() {
+	c.removals.overridden.Set(true)
+	select {
+	case c.overrideCh <- struct{}{}:
+	default:
+	}
+}
+
 func (c *controller) Health() error {
 	c.Lock()
 	defer c.Unlock()
@@ -415,9 +906,13 @@ func (c *controller) Health() error {
 		}
 	}
 
-	if err := c.updatesHealth.Get(); err != nil {
+	if err := c.updatesHealth.get(); err != nil {
 		return fmt.Errorf("updates failed to apply: %v", err)
 	}
 
+	if c.degraded.Get() {
+		return errors.New(usingSnapshot)
+	}
+
 	return nil
 }
@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/util/metrics"
+)
+
+var once sync.Once
+var blockedRemovalsGauge prometheus.Gauge
+var watchEventsCount, coalescedWatchEventsCount, ignoredWatchEventsCount prometheus.Counter
+
+func initMetrics(subsystem string) {
+	once.Do(func() {
+		blockedRemovalsGauge = metrics.RegisterNewDefaultGauge(subsystem, "blocked_entry_removals",
+			"The number of ingress entries the latest update would have removed, if it was refused for exceeding "+
+				"the removal threshold. 0 if the latest update was accepted.")
+		watchEventsCount = metrics.RegisterNewDefaultCounter(subsystem, "watch_events",
+			"The number of updates received from Kubernetes watchers which could affect ingress entries.")
+		coalescedWatchEventsCount = metrics.RegisterNewDefaultCounter(subsystem, "coalesced_watch_events",
+			"The number of updates received from Kubernetes watchers which were coalesced into an earlier delayed update.")
+		ignoredWatchEventsCount = metrics.RegisterNewDefaultCounter(subsystem, "ignored_watch_events",
+			"The number of updates received from Kubernetes watchers which couldn't affect ingress entries.")
+	})
+}
@@ -3,20 +3,31 @@ package controller
 import (
 	"errors"
 	"fmt"
+	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/sky-uk/feed/k8s"
+	"github.com/sky-uk/feed/util/metrics"
 	fake "github.com/sky-uk/feed/util/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/record"
 )
 
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
 const smallWaitTime = time.Millisecond * 50
 const defaultIngressClass = "main"
 
@@ -54,6 +65,15 @@ func (lb *fakeUpdater) String() string {
 	return "FakeUpdater"
 }
 
+type fakeDeltaUpdater struct {
+	fakeUpdater
+}
+
+func (lb *fakeDeltaUpdater) UpdateDelta(entries IngressEntries, delta IngressEntriesDelta) error {
+	r := lb.Called(entries, delta)
+	return r.Error(0)
+}
+
 type fakeWatcher struct {
 	mock.Mock
 }
@@ -76,13 +96,16 @@ func createDefaultStubs() (*fakeUpdater, *fake.FakeClient) {
 	ingressWatcher, _ := createFakeWatcher()
 	serviceWatcher, _ := createFakeWatcher()
 	namespaceWatcher, _ := createFakeWatcher()
+	ingressClassWatcher, _ := createFakeWatcher()
 
-	client.On("GetAllIngresses").Return([]*v1beta1.Ingress{}, nil)
-	client.On("GetIngresses", mock.Anything).Return([]*v1beta1.Ingress{}, nil)
+	client.On("GetAllIngresses").Return([]*networkingv1.Ingress{}, nil)
+	client.On("GetIngresses", mock.Anything).Return([]*networkingv1.Ingress{}, nil)
 	client.On("GetServices").Return([]*v1.Service{}, nil)
+	client.On("GetIngressClasses").Return([]*networkingv1.IngressClass{}, nil)
 	client.On("WatchIngresses").Return(ingressWatcher)
 	client.On("WatchServices").Return(serviceWatcher)
 	client.On("WatchNamespaces").Return(namespaceWatcher)
+	client.On("WatchIngressClasses").Return(ingressClassWatcher)
 	updater.On("Start").Return(nil)
 	updater.On("Stop").Return(nil)
 	updater.On("Update", mock.Anything).Return(nil)
@@ -111,6 +134,20 @@ func TestControllerCanBeStartedAndStopped(t *testing.T) {
 	updater.AssertCalled(t, "Stop")
 }
 
+func TestControllerStopsClientWithoutLeakingGoroutines(t *testing.T) {
+	asserter := assert.New(t)
+	updater, client := createDefaultStubs()
+	before := runtime.NumGoroutine()
+	controller := newController(updater, client)
+
+	asserter.NoError(controller.Start())
+	asserter.NoError(controller.Stop())
+
+	asserter.True(client.Stopped)
+	asserter.Eventually(func() bool { return runtime.NumGoroutine() <= before }, time.Second, smallWaitTime,
+		"goroutines still running after stopping")
+}
+
 func TestControllerStartsAndStopsUpdatersInCorrectOrder(t *testing.T) {
 	// given
 	asserter := assert.New(t)
@@ -253,6 +290,7 @@ func TestUnhealthyIfUpdaterFails(t *testing.T) {
 	ingressWatcher, updateCh := createFakeWatcher()
 	serviceWatcher, _ := createFakeWatcher()
 	namespaceWatcher, _ := createFakeWatcher()
+	ingressClassWatcher, _ := createFakeWatcher()
 
 	updater.On("Start").Return(nil)
 	updater.On("Stop").Return(nil)
@@ -262,9 +300,11 @@ func TestUnhealthyIfUpdaterFails(t *testing.T) {
 
 	client.On("GetAllIngresses").Return(createDefaultIngresses(), nil)
 	client.On("GetServices").Return(createDefaultServices(), nil)
+	client.On("GetIngressClasses").Return([]*networkingv1.IngressClass{}, nil)
 	client.On("WatchIngresses").Return(ingressWatcher)
 	client.On("WatchServices").Return(serviceWatcher)
 	client.On("WatchNamespaces").Return(namespaceWatcher)
+	client.On("WatchIngressClasses").Return(ingressClassWatcher)
 	asserter.NoError(controller.Start())
 
 	// expect
@@ -280,6 +320,110 @@ func TestUnhealthyIfUpdaterFails(t *testing.T) {
 	_ = controller.Stop()
 }
 
+func TestDeltaUpdaterIsOnlyUpdatedWhenEntriesChange(t *testing.T) {
+	// given
+	asserter := assert.New(t)
+	updater := new(fakeDeltaUpdater)
+	client := new(fake.FakeClient)
+	config := defaultConfig()
+	config.KubernetesClient = client
+	config.Updaters = []Updater{updater}
+	controller := New(config)
+
+	ingressWatcher, updateCh := createFakeWatcher()
+	serviceWatcher, _ := createFakeWatcher()
+	namespaceWatcher, _ := createFakeWatcher()
+	ingressClassWatcher, _ := createFakeWatcher()
+
+	ingresses := createDefaultIngresses()
+	entries := addIngresses(ingresses, createLbEntriesFixture())
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("UpdateDelta", entries, IngressEntriesDelta{Added: entries}).Return(errors.New("kaboom")).Once()
+	updater.On("UpdateDelta", entries, IngressEntriesDelta{Added: entries}).Return(nil).Once()
+	updater.On("Health").Return(nil)
+
+	client.On("GetAllIngresses").Return(ingresses, nil)
+	client.On("GetServices").Return(createDefaultServices(), nil)
+	client.On("GetIngressClasses").Return([]*networkingv1.IngressClass{}, nil)
+	client.On("WatchIngresses").Return(ingressWatcher)
+	client.On("WatchServices").Return(serviceWatcher)
+	client.On("WatchNamespaces").Return(namespaceWatcher)
+	client.On("WatchIngressClasses").Return(ingressClassWatcher)
+	asserter.NoError(controller.Start())
+
+	// expect
+	updateCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+	asserter.Error(controller.Health(), "failed update should be unhealthy")
+
+	updateCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+	asserter.NoError(controller.Health(), "failed update should be retried with the same delta")
+
+	updateCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+	asserter.NoError(controller.Health())
+	updater.AssertNumberOfCalls(t, "UpdateDelta", 2)
+	updater.AssertNotCalled(t, "Update", mock.Anything)
+
+	// cleanup
+	_ = controller.Stop()
+}
+
+func TestUpdatersAreUpdatedIndependentlyAndRetriedIfTheyFail(t *testing.T) {
+	// given
+	asserter := assert.New(t)
+	failingUpdater := new(fakeUpdater)
+	updater := new(fakeUpdater)
+	client := new(fake.FakeClient)
+	config := defaultConfig()
+	config.KubernetesClient = client
+	config.Updaters = []Updater{failingUpdater, updater}
+	config.UpdateRetryInitialBackoff = smallWaitTime
+	controller := New(config)
+
+	ingressWatcher, updateCh := createFakeWatcher()
+	serviceWatcher, _ := createFakeWatcher()
+	namespaceWatcher, _ := createFakeWatcher()
+	ingressClassWatcher, _ := createFakeWatcher()
+
+	for _, u := range []*fakeUpdater{failingUpdater, updater} {
+		u.On("Start").Return(nil)
+		u.On("Stop").Return(nil)
+		u.On("Health").Return(nil)
+	}
+	failingUpdater.On("Update", mock.Anything).Return(errors.New("kaboom")).Once()
+	failingUpdater.On("Update", mock.Anything).Return(nil).Once()
+	updater.On("Update", mock.Anything).Return(nil).Once()
+
+	client.On("GetAllIngresses").Return(createDefaultIngresses(), nil)
+	client.On("GetServices").Return(createDefaultServices(), nil)
+	client.On("GetIngressClasses").Return([]*networkingv1.IngressClass{}, nil)
+	client.On("WatchIngresses").Return(ingressWatcher)
+	client.On("WatchServices").Return(serviceWatcher)
+	client.On("WatchNamespaces").Return(namespaceWatcher)
+	client.On("WatchIngressClasses").Return(ingressClassWatcher)
+	asserter.NoError(controller.Start())
+
+	// when
+	updateCh <- struct{}{}
+	time.Sleep(smallWaitTime / 2)
+
+	// then
+	asserter.EqualError(controller.Health(), "updates failed to apply: FakeUpdater: kaboom")
+	updater.AssertNumberOfCalls(t, "Update", 1)
+
+	// and the failed updater is retried without another watch event
+	time.Sleep(smallWaitTime * 2)
+	asserter.NoError(controller.Health())
+	failingUpdater.AssertNumberOfCalls(t, "Update", 2)
+	updater.AssertNumberOfCalls(t, "Update", 1)
+
+	// cleanup
+	_ = controller.Stop()
+}
+
 func defaultConfig() Config {
 	return Config{
 		DefaultAllow:                 ingressDefaultAllow,
@@ -290,7 +434,7 @@ func defaultConfig() Config {
 
 type testSpec struct {
 	description string
-	ingresses   []*v1beta1.Ingress
+	ingresses   []*networkingv1.Ingress
 	services    []*v1.Service
 	namespaces  []*v1.Namespace
 	entries     IngressEntries
@@ -470,6 +614,7 @@ func TestUpdaterIsUpdatedForIngressWithDefaultAllow(t *testing.T) {
 			Host:                  ingressHost,
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
 			ServicePort:           ingressSvcPort,
 			Allow:                 strings.Split(ingressDefaultAllow, ","),
 			IngressClass:          defaultIngressClass,
@@ -496,6 +641,7 @@ func TestUpdaterIsUpdatedForIngressWithEmptyAllow(t *testing.T) {
 			Host:                  ingressHost,
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
 			ServicePort:           ingressSvcPort,
 			LbScheme:              "internal",
 			IngressClass:          defaultIngressClass,
@@ -524,6 +670,7 @@ func TestUpdaterIsUpdatedForIngressWithStripPathsTrue(t *testing.T) {
 			Host:                  ingressHost,
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
 			ServicePort:           ingressSvcPort,
 			LbScheme:              "internal",
 			IngressClass:          defaultIngressClass,
@@ -553,6 +700,7 @@ func TestUpdaterIsUpdatedForIngressWithStripPathsFalse(t *testing.T) {
 			Host:                  ingressHost,
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
 			ServicePort:           ingressSvcPort,
 			LbScheme:              "internal",
 			IngressClass:          defaultIngressClass,
@@ -582,6 +730,7 @@ func TestUpdaterIsUpdatedForIngressWithExactPathTrue(t *testing.T) {
 			Host:                  ingressHost,
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
 			ServicePort:           ingressSvcPort,
 			LbScheme:              "internal",
 			IngressClass:          defaultIngressClass,
@@ -611,6 +760,67 @@ func TestUpdaterIsUpdatedForIngressWithExactPathFalse(t *testing.T) {
 			Host:                  ingressHost,
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "internal",
+			IngressClass:          defaultIngressClass,
+			Allow:                 []string{},
+			ExactPath:             false,
+			BackendTimeoutSeconds: backendTimeout,
+		}},
+		defaultConfig(),
+	})
+}
+
+func TestUpdaterIsUpdatedForIngressWithExactPathType(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with exact path type overriding the exact path annotation",
+		withPathType(createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			exactPathAnnotation:      "false",
+			backendTimeoutSeconds:    "10",
+			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   defaultIngressClass,
+		}, ingressPath), networkingv1.PathTypeExact),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "internal",
+			IngressClass:          defaultIngressClass,
+			Allow:                 []string{},
+			ExactPath:             true,
+			BackendTimeoutSeconds: backendTimeout,
+		}},
+		defaultConfig(),
+	})
+}
+
+func TestUpdaterIsUpdatedForIngressWithPrefixPathType(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with prefix path type overriding the exact path annotation",
+		withPathType(createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			exactPathAnnotation:      "true",
+			backendTimeoutSeconds:    "10",
+			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   defaultIngressClass,
+		}, ingressPath), networkingv1.PathTypePrefix),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
 			ServicePort:           ingressSvcPort,
 			LbScheme:              "internal",
 			IngressClass:          defaultIngressClass,
@@ -622,6 +832,36 @@ func TestUpdaterIsUpdatedForIngressWithExactPathFalse(t *testing.T) {
 	})
 }
 
+func TestUpdaterIsUpdatedForIngressWithImplementationSpecificPathType(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with implementation specific path type using the exact path annotation",
+		withPathType(createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			exactPathAnnotation:      "true",
+			backendTimeoutSeconds:    "10",
+			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   defaultIngressClass,
+		}, ingressPath), networkingv1.PathTypeImplementationSpecific),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "internal",
+			IngressClass:          defaultIngressClass,
+			Allow:                 []string{},
+			ExactPath:             true,
+			BackendTimeoutSeconds: backendTimeout,
+		}},
+		defaultConfig(),
+	})
+}
+
 func TestUpdaterIsUpdatedForIngressWithOverriddenBackendTimeout(t *testing.T) {
 	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
 		"ingress with overridden backend timeout",
@@ -640,6 +880,7 @@ func TestUpdaterIsUpdatedForIngressWithOverriddenBackendTimeout(t *testing.T) {
 			Host:                  ingressHost,
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
 			ServicePort:           ingressSvcPort,
 			LbScheme:              "internal",
 			IngressClass:          defaultIngressClass,
@@ -669,6 +910,7 @@ func TestUpdaterIsUpdatedForIngressWithOverriddenLegacyBackendTimeout(t *testing
 			Host:                  ingressHost,
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
 			ServicePort:           ingressSvcPort,
 			LbScheme:              "internal",
 			IngressClass:          defaultIngressClass,
@@ -697,6 +939,7 @@ func TestUpdaterIsUpdatedForIngressWithDefaultBackendTimeout(t *testing.T) {
 			Host:                  ingressHost,
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
 			ServicePort:           ingressSvcPort,
 			LbScheme:              "internal",
 			IngressClass:          defaultIngressClass,
@@ -727,6 +970,7 @@ func TestUpdaterIsUpdatedForIngressWithOverriddenBackendMaxConnections(t *testin
 			Host:                  ingressHost,
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
 			ServicePort:           ingressSvcPort,
 			LbScheme:              "internal",
 			IngressClass:          defaultIngressClass,
@@ -757,6 +1001,7 @@ func TestUpdaterIsUpdatedForIngressWithDefaultBackendMaxConnections(t *testing.T
 			Host:                  ingressHost,
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
 			ServicePort:           ingressSvcPort,
 			LbScheme:              "internal",
 			IngressClass:          defaultIngressClass,
@@ -784,6 +1029,7 @@ func TestUpdaterIsUpdatedForIngressWithDefaultProxyBufferValuesWhenNotOverridden
 			Host:                  ingressHost,
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
 			ServicePort:           ingressSvcPort,
 			LbScheme:              "",
 			IngressClass:          defaultIngressClass,
@@ -820,6 +1066,7 @@ func TestUpdaterIsUpdatedForIngressOverridesDefaultProxyBufferValues(t *testing.
 			Host:                  ingressHost,
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
 			ServicePort:           ingressSvcPort,
 			LbScheme:              "",
 			IngressClass:          defaultIngressClass,
@@ -856,6 +1103,7 @@ func TestUpdaterIsUpdatedForIngressDefinitionResetsToMacWhenProxyBufferValuesExc
 			Host:                  ingressHost,
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
 			ServicePort:           ingressSvcPort,
 			LbScheme:              "",
 			IngressClass:          defaultIngressClass,
@@ -893,6 +1141,7 @@ func TestUpdaterIsUpdatedForIngressClassNotSetInIngress(t *testing.T) {
 			Host:                  ingressHost,
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
 			ServicePort:           ingressSvcPort,
 			LbScheme:              "internal",
 			IngressClass:          defaultIngressClass,
@@ -922,6 +1171,7 @@ func TestUpdaterIsUpdatedForIngressClassSetToDefaultInIngress(t *testing.T) {
 			Host:                  ingressHost,
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
 			ServicePort:           ingressSvcPort,
 			LbScheme:              "internal",
 			Allow:                 []string{},
@@ -971,6 +1221,7 @@ func TestUpdaterIsUpdatedWhenIncludingClasslessIngresses(t *testing.T) {
 			Host:                  ingressHost,
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
 			ServicePort:           ingressSvcPort,
 			LbScheme:              "internal",
 			Allow:                 []string{},
@@ -1026,6 +1277,7 @@ func TestUpdaterIsUpdatedForIngressClassSetToTestInIngressAndConfig(t *testing.T
 			Host:                  ingressHost,
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
 			ServicePort:           ingressSvcPort,
 			LbScheme:              "internal",
 			Allow:                 []string{},
@@ -1041,6 +1293,114 @@ func TestUpdaterIsUpdatedForIngressClassSetToTestInIngressAndConfig(t *testing.T
 	})
 }
 
+func TestUpdaterIsUpdatedForIngressClassNameOwnedByThisInstance(t *testing.T) {
+	runAndAssertUpdatesWithIngressClasses(t, expectGetAllIngresses, testSpec{
+		"ingress requesting an IngressClass handled by this instance",
+		withIngressClassName(createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			backendTimeoutSeconds:    "10",
+			frontendSchemeAnnotation: "internal",
+		}, ingressPath), "feed-main"),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "internal",
+			Allow:                 []string{},
+			BackendTimeoutSeconds: backendTimeout,
+			IngressClass:          "feed-main",
+		}},
+		defaultConfig(),
+	}, []*networkingv1.IngressClass{
+		createIngressClassFixture("feed-main", IngressClassController(defaultIngressClass), false),
+	})
+}
+
+func TestUpdaterIsNotUpdatedForIngressClassNameOwnedByAnotherController(t *testing.T) {
+	runAndAssertUpdatesWithIngressClasses(t, expectGetAllIngresses, testSpec{
+		"ingress requesting an IngressClass handled by another controller",
+		withIngressClassName(createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			backendTimeoutSeconds:    "10",
+			frontendSchemeAnnotation: "internal",
+		}, ingressPath), "nginx"),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		nil,
+		defaultConfig(),
+	}, []*networkingv1.IngressClass{
+		createIngressClassFixture("feed-main", IngressClassController(defaultIngressClass), false),
+		createIngressClassFixture("nginx", "k8s.io/ingress-nginx", false),
+	})
+}
+
+func TestUpdaterIsNotUpdatedForIngressClassNameWithoutIngressClass(t *testing.T) {
+	runAndAssertUpdatesWithIngressClasses(t, expectGetAllIngresses, testSpec{
+		"ingress requesting an IngressClass which doesn't exist",
+		withIngressClassName(createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			backendTimeoutSeconds:    "10",
+			frontendSchemeAnnotation: "internal",
+		}, ingressPath), defaultIngressClass),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		nil,
+		defaultConfig(),
+	}, []*networkingv1.IngressClass{})
+}
+
+func TestUpdaterIsUpdatedForClasslessIngressWhenOwningDefaultIngressClass(t *testing.T) {
+	runAndAssertUpdatesWithIngressClasses(t, expectGetAllIngresses, testSpec{
+		"ingress without a class; this instance handles the default IngressClass",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			backendTimeoutSeconds:    "10",
+			frontendSchemeAnnotation: "internal",
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServiceName:           ingressSvcName,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "internal",
+			Allow:                 []string{},
+			BackendTimeoutSeconds: backendTimeout,
+		}},
+		defaultConfig(),
+	}, []*networkingv1.IngressClass{
+		createIngressClassFixture("feed-main", IngressClassController(defaultIngressClass), true),
+	})
+}
+
+func TestUpdaterIsNotUpdatedForClasslessIngressWhenDefaultIngressClassBelongsToAnotherInstance(t *testing.T) {
+	runAndAssertUpdatesWithIngressClasses(t, expectGetAllIngresses, testSpec{
+		"ingress without a class; another instance handles the default IngressClass",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			backendTimeoutSeconds:    "10",
+			frontendSchemeAnnotation: "internal",
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		nil,
+		defaultConfig(),
+	}, []*networkingv1.IngressClass{
+		createIngressClassFixture("feed-main", IngressClassController(defaultIngressClass), false),
+		createIngressClassFixture("feed-other", IngressClassController("other"), true),
+	})
+}
+
 func TestNamespaceSelectorIsUsedToGetIngresses(t *testing.T) {
 	asserter := assert.New(t)
 
@@ -1064,14 +1424,16 @@ func TestNamespaceSelectorIsUsedToGetIngresses(t *testing.T) {
 	updater.On("Health").Return(nil)
 
 	// The purpose of this test is to ensure that the NamespaceSelector is passed to GetIngresses
-	client.On("GetIngresses", &k8s.NamespaceSelector{LabelName: "team", LabelValue: "theteam"}).Return([]*v1beta1.Ingress{}, nil)
+	client.On("GetIngresses", &k8s.NamespaceSelector{LabelName: "team", LabelValue: "theteam"}).Return([]*networkingv1.Ingress{}, nil)
 
 	ingressWatcher, ingressCh := createFakeWatcher()
 	serviceWatcher, serviceCh := createFakeWatcher()
 	namespaceWatcher, namespaceCh := createFakeWatcher()
+	ingressClassWatcher, _ := createFakeWatcher()
 	client.On("WatchIngresses").Return(ingressWatcher)
 	client.On("WatchServices").Return(serviceWatcher)
 	client.On("WatchNamespaces").Return(namespaceWatcher)
+	client.On("WatchIngressClasses").Return(ingressClassWatcher)
 
 	asserter.NoError(controller.Start())
 	ingressCh <- struct{}{}
@@ -1086,6 +1448,385 @@ func TestNamespaceSelectorIsUsedToGetIngresses(t *testing.T) {
 	client.AssertExpectations(t)
 }
 
+func TestIngressSelectorIsUsedToFilterIngresses(t *testing.T) {
+	// given
+	asserter := assert.New(t)
+	client := new(fake.FakeClient)
+	updater := new(fakeUpdater)
+	config := defaultConfig()
+	config.KubernetesClient = client
+	config.Updaters = []Updater{updater}
+	selector, err := labels.Parse("shard in (a,b),!canary")
+	asserter.NoError(err)
+	config.IngressSelector = selector
+	controller := New(config)
+
+	var ingresses []*networkingv1.Ingress
+	for i, ingressLabels := range []map[string]string{
+		{"shard": "a"},
+		{"shard": "c"},
+		{"shard": "b", "canary": "true"},
+		nil,
+	} {
+		ingress := createDefaultIngresses()[0]
+		ingress.Name = fmt.Sprintf("ingress-%d", i)
+		ingress.Labels = ingressLabels
+		ingresses = append(ingresses, ingress)
+	}
+
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Health").Return(nil)
+	updater.On("Update", mock.Anything).Return(nil)
+	client.On("GetAllIngresses").Return(ingresses, nil)
+	client.On("GetServices").Return(createDefaultServices(), nil)
+	client.On("GetIngressClasses").Return([]*networkingv1.IngressClass{}, nil)
+	ingressWatcher, ingressCh := createFakeWatcher()
+	serviceWatcher, _ := createFakeWatcher()
+	namespaceWatcher, _ := createFakeWatcher()
+	ingressClassWatcher, _ := createFakeWatcher()
+	client.On("WatchIngresses").Return(ingressWatcher)
+	client.On("WatchServices").Return(serviceWatcher)
+	client.On("WatchNamespaces").Return(namespaceWatcher)
+	client.On("WatchIngressClasses").Return(ingressClassWatcher)
+
+	// when
+	asserter.NoError(controller.Start())
+	ingressCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+
+	// then
+	updater.AssertNumberOfCalls(t, "Update", 1)
+	entries := updater.Calls[len(updater.Calls)-1].Arguments.Get(0).(IngressEntries)
+	if asserter.Len(entries, 1) {
+		asserter.Equal("ingress-0", entries[0].Name)
+	}
+	asserter.NoError(controller.Stop())
+}
+
+func TestUpdaterIsUpdatedWithEndpointsForIngressRoutingToEndpoints(t *testing.T) {
+	entries := createLbEntriesFixture()
+	entries[0].RouteToEndpoints = true
+	entries[0].Endpoints = []Endpoint{{Address: "10.2.0.1", Port: 8080}, {Address: "10.2.0.2", Port: 8080}}
+
+	config := defaultConfig()
+	config.WatchEndpoints = true
+
+	runAndAssertUpdatesWithEndpoints(t, expectGetAllIngresses, testSpec{
+		"ingress routing to endpoints",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:     ingressAllow,
+			backendTimeoutSeconds:      "10",
+			frontendSchemeAnnotation:   "internal",
+			ingressClassAnnotation:     defaultIngressClass,
+			routeToEndpointsAnnotation: "true",
+		}, ingressPath),
+		withServicePort(createDefaultServices(), "http", ingressSvcPort),
+		createDefaultNamespaces(),
+		entries,
+		config,
+	}, []*v1.Endpoints{
+		createEndpointsFixture(ingressSvcName, ingressNamespace, "http", 8080,
+			[]string{"10.2.0.2", "10.2.0.1"}, []string{"10.2.0.3"}),
+		createEndpointsFixture("another-svc", ingressNamespace, "http", 9090, []string{"10.2.1.1"}, nil),
+	})
+}
+
+func TestUpdaterIsUpdatedWithEndpointsForHeadlessServiceWhenRoutingToEndpointsByDefault(t *testing.T) {
+	entries := createLbEntriesFixture()
+	entries[0].ServiceAddress = "None"
+	entries[0].RouteToEndpoints = true
+	entries[0].Endpoints = []Endpoint{{Address: "10.2.0.1", Port: 8080}}
+
+	config := defaultConfig()
+	config.DefaultRouteToEndpoints = true
+
+	runAndAssertUpdatesWithEndpoints(t, expectGetAllIngresses, testSpec{
+		"headless service routing to endpoints by default",
+		createDefaultIngresses(),
+		withServicePort(createServiceFixture(ingressSvcName, ingressNamespace, "None"), "", ingressSvcPort),
+		createDefaultNamespaces(),
+		entries,
+		config,
+	}, []*v1.Endpoints{
+		createEndpointsFixture(ingressSvcName, ingressNamespace, "", 8080, []string{"10.2.0.1"}, nil),
+	})
+}
+
+func TestUpdaterIsUpdatedWithServiceAddressWhenIngressOptsOutOfRoutingToEndpoints(t *testing.T) {
+	config := defaultConfig()
+	config.DefaultRouteToEndpoints = true
+
+	runAndAssertUpdatesWithEndpoints(t, expectGetAllIngresses, testSpec{
+		"ingress opting out of routing to endpoints",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:     ingressAllow,
+			backendTimeoutSeconds:      "10",
+			frontendSchemeAnnotation:   "internal",
+			ingressClassAnnotation:     defaultIngressClass,
+			routeToEndpointsAnnotation: "false",
+		}, ingressPath),
+		withServicePort(createDefaultServices(), "", ingressSvcPort),
+		createDefaultNamespaces(),
+		createLbEntriesFixture(),
+		config,
+	}, []*v1.Endpoints{
+		createEndpointsFixture(ingressSvcName, ingressNamespace, "", 8080, []string{"10.2.0.1"}, nil),
+	})
+}
+
+func TestUpdaterIsUpdatedWithoutIngressRoutingToServiceWithNoReadyEndpoints(t *testing.T) {
+	config := defaultConfig()
+	config.DefaultRouteToEndpoints = true
+
+	runAndAssertUpdatesWithEndpoints(t, expectGetAllIngresses, testSpec{
+		"ingress routing to a service without ready endpoints",
+		createDefaultIngresses(),
+		withServicePort(createDefaultServices(), "", ingressSvcPort),
+		createDefaultNamespaces(),
+		nil,
+		config,
+	}, []*v1.Endpoints{
+		createEndpointsFixture(ingressSvcName, ingressNamespace, "", 8080, nil, []string{"10.2.0.1"}),
+	})
+}
+
+func TestUpdaterIsUpdatedWithServiceAddressWhenEndpointsAreNotWatched(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress routing to endpoints when endpoints aren't watched",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:     ingressAllow,
+			backendTimeoutSeconds:      "10",
+			frontendSchemeAnnotation:   "internal",
+			ingressClassAnnotation:     defaultIngressClass,
+			routeToEndpointsAnnotation: "true",
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		createLbEntriesFixture(),
+		defaultConfig(),
+	})
+}
+
+func TestUpdaterIsUpdatedForIngressWithNamedServicePort(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with a named service port",
+		withServicePortName(createDefaultIngresses(), "http"),
+		withServicePort(withServicePort(createDefaultServices(), "admin", 9000), "http", ingressSvcPort),
+		createDefaultNamespaces(),
+		createLbEntriesFixture(),
+		defaultConfig(),
+	})
+}
+
+func TestUpdaterIsUpdatedForIngressWithUnknownNamedServicePort(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with a named service port missing from the service",
+		withServicePortName(createDefaultIngresses(), "http"),
+		withServicePort(createDefaultServices(), "admin", 9000),
+		createDefaultNamespaces(),
+		nil,
+		defaultConfig(),
+	})
+}
+
+func TestUpdaterIsUpdatedWithEndpointsForIngressWithNamedServicePort(t *testing.T) {
+	entries := createLbEntriesFixture()
+	entries[0].RouteToEndpoints = true
+	entries[0].Endpoints = []Endpoint{{Address: "10.2.0.1", Port: 8080}}
+
+	config := defaultConfig()
+	config.DefaultRouteToEndpoints = true
+
+	runAndAssertUpdatesWithEndpoints(t, expectGetAllIngresses, testSpec{
+		"ingress with a named service port routing to endpoints",
+		withServicePortName(createDefaultIngresses(), "http"),
+		withServicePort(createDefaultServices(), "http", ingressSvcPort),
+		createDefaultNamespaces(),
+		entries,
+		config,
+	}, []*v1.Endpoints{
+		createEndpointsFixture(ingressSvcName, ingressNamespace, "http", 8080, []string{"10.2.0.1"}, nil),
+	})
+}
+
+func TestUpdaterIsUpdatedWithEndpointPortForHeadlessServiceWithoutPorts(t *testing.T) {
+	entries := createLbEntriesFixture()
+	entries[0].ServiceAddress = "None"
+	entries[0].ServicePort = 8080
+	entries[0].RouteToEndpoints = true
+	entries[0].Endpoints = []Endpoint{{Address: "10.2.0.1", Port: 8080}}
+
+	config := defaultConfig()
+	config.DefaultRouteToEndpoints = true
+
+	runAndAssertUpdatesWithEndpoints(t, expectGetAllIngresses, testSpec{
+		"ingress with a named port of a headless service that doesn't declare it",
+		withServicePortName(createDefaultIngresses(), "http"),
+		createServiceFixture(ingressSvcName, ingressNamespace, "None"),
+		createDefaultNamespaces(),
+		entries,
+		config,
+	}, []*v1.Endpoints{
+		createEndpointsFixture(ingressSvcName, ingressNamespace, "http", 8080, []string{"10.2.0.1"}, nil),
+	})
+}
+
+// customAnnotation is registered by library users, rather than built in.
+const customAnnotation = "example.com/team"
+
+func TestUpdaterIsUpdatedWithAttributesFromRegisteredAnnotations(t *testing.T) {
+	annotations := NewAnnotationRegistry()
+	assert.NoError(t, annotations.Register(AnnotationHandler{
+		Annotation: customAnnotation,
+		Parse: func(value string, entry *IngressEntry) error {
+			entry.SetAttribute(customAnnotation, value)
+			return nil
+		},
+	}))
+	config := defaultConfig()
+	config.Annotations = annotations
+
+	entries := createLbEntriesFixture()
+	entries[0].SetAttribute(customAnnotation, "ingress")
+
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with a registered annotation",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   ingressAllow,
+			backendTimeoutSeconds:    "10",
+			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   defaultIngressClass,
+			customAnnotation:         "ingress",
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		entries,
+		config,
+	})
+}
+
+func TestUpdaterIsUpdatedWithDefaultsForIngressWithInvalidAnnotations(t *testing.T) {
+	entries := createLbEntriesFixture()
+	entries[0].ProxyBufferSize = 2
+
+	config := defaultConfig()
+	config.DefaultProxyBufferSize = 2
+
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with invalid annotations uses the defaults",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:    ingressAllow,
+			backendTimeoutSeconds:     "1O",
+			frontendSchemeAnnotation:  "internal",
+			ingressClassAnnotation:    defaultIngressClass,
+			proxyBufferSizeAnnotation: "0",
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		entries,
+		config,
+	})
+}
+
+func TestUpdaterIsUpdatedWithoutIngressWithInvalidAnnotationsInStrictMode(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	config := defaultConfig()
+	config.StrictAnnotations = true
+	config.EventRecorder = recorder
+
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with invalid annotations in strict mode",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   ingressAllow,
+			backendTimeoutSeconds:    "1O",
+			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   defaultIngressClass,
+			backendMaxConnections:    "-1",
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		nil,
+		config,
+	})
+
+	assert.Equal(t, "Warning InvalidAnnotation foo.sky.com/foo: "+
+		"invalid sky.uk/backend-timeout-seconds annotation [1O]: must be a whole number; "+
+		"invalid sky.uk/backend-max-connections annotation [-1]: must be at least 0", <-recorder.Events)
+}
+
+func TestEventIsRecordedForIngressWithoutCorrespondingService(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	config := defaultConfig()
+	config.EventRecorder = recorder
+
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress without corresponding service",
+		createDefaultIngresses(),
+		createServiceFixture("another-svc", ingressNamespace, serviceIP),
+		createDefaultNamespaces(),
+		nil,
+		config,
+	})
+
+	assert.Equal(t, "Warning ServiceNotFound service foo-svc doesn't exist", <-recorder.Events)
+	assert.Empty(t, recorder.Events, "repeated updates shouldn't record the event again")
+}
+
+func TestIngressOfAnotherClassIsLoggedWithoutEvents(t *testing.T) {
+	logs := logtest.NewGlobal()
+	defer logs.Reset()
+	recorder := record.NewFakeRecorder(10)
+	config := defaultConfig()
+	config.EventRecorder = recorder
+	ingresses := createDefaultIngresses()
+	ingresses[0].Annotations[ingressClassAnnotation] = "another-class"
+	ingresses[0].Annotations[backendTimeoutSeconds] = "invalid"
+
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress of another class without a corresponding service",
+		ingresses,
+		createServiceFixture("another-svc", ingressNamespace, serviceIP),
+		createDefaultNamespaces(),
+		nil,
+		config,
+	})
+
+	assert.Empty(t, recorder.Events)
+	var updateLogs []string
+	for _, entry := range logs.AllEntries() {
+		if entry.Level == log.InfoLevel && strings.HasPrefix(entry.Message, "Updating with") {
+			updateLogs = append(updateLogs, entry.Message)
+		}
+	}
+	assert.Contains(t, updateLogs, "Updating with 0 entries from 1 total ingresses (skipped 0, ignored 1 of other classes)")
+}
+
+func TestEventIsRecordedForIngressWithInvalidAnnotation(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	config := defaultConfig()
+	config.EventRecorder = recorder
+
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with an invalid strip path annotation",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   ingressAllow,
+			backendTimeoutSeconds:    "10",
+			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   defaultIngressClass,
+			stripPathAnnotation:      "yes",
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		createLbEntriesFixture(),
+		config,
+	})
+
+	assert.Equal(t, "Warning InvalidAnnotation invalid sky.uk/strip-path annotation [yes]: must be true or false, using the default",
+		<-recorder.Events)
+	assert.Empty(t, recorder.Events)
+}
+
 func TestUpdaterIsUpdatedForIngressWithoutHostDefinition(t *testing.T) {
 	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
 		"ingress without host definition",
@@ -1123,17 +1864,33 @@ func TestUpdaterIsUpdatedForIngressWithoutRulesDefinition(t *testing.T) {
 	})
 }
 
-type clientExpectation func(client *fake.FakeClient, ingresses []*v1beta1.Ingress)
+type clientExpectation func(client *fake.FakeClient, ingresses []*networkingv1.Ingress)
 
-var expectGetAllIngresses = func(client *fake.FakeClient, ingresses []*v1beta1.Ingress) {
+var expectGetAllIngresses = func(client *fake.FakeClient, ingresses []*networkingv1.Ingress) {
 	client.On("GetAllIngresses").Return(ingresses, nil)
 }
 
-var expectGetIngresses = func(client *fake.FakeClient, ingresses []*v1beta1.Ingress) {
+var expectGetIngresses = func(client *fake.FakeClient, ingresses []*networkingv1.Ingress) {
 	client.On("GetIngresses", &k8s.NamespaceSelector{LabelName: "team", LabelValue: "theteam"}).Return(ingresses, nil)
 }
 
 func runAndAssertUpdates(t *testing.T, clientExpectation clientExpectation, test testSpec) {
+	runAndAssertUpdatesWithIngressClasses(t, clientExpectation, test, []*networkingv1.IngressClass{})
+}
+
+func runAndAssertUpdatesWithIngressClasses(t *testing.T, clientExpectation clientExpectation, test testSpec,
+	ingressClasses []*networkingv1.IngressClass) {
+	runAndAssertUpdatesWithResources(t, clientExpectation, test, ingressClasses, nil)
+}
+
+func runAndAssertUpdatesWithEndpoints(t *testing.T, clientExpectation clientExpectation, test testSpec,
+	endpoints []*v1.Endpoints) {
+	runAndAssertUpdatesWithResources(t, clientExpectation, test, []*networkingv1.IngressClass{}, endpoints)
+}
+
+// runAndAssertUpdatesWithResources expects endpoints to be requested from the client if they are non-nil.
+func runAndAssertUpdatesWithResources(t *testing.T, clientExpectation clientExpectation, test testSpec,
+	ingressClasses []*networkingv1.IngressClass, endpoints []*v1.Endpoints) {
 	//given
 	asserter := assert.New(t)
 
@@ -1159,13 +1916,21 @@ func runAndAssertUpdates(t *testing.T, clientExpectation clientExpectation, test
 
 	clientExpectation(client, test.ingresses)
 	client.On("GetServices").Return(test.services, nil)
+	client.On("GetIngressClasses").Return(ingressClasses, nil)
 
 	ingressWatcher, ingressCh := createFakeWatcher()
 	serviceWatcher, serviceCh := createFakeWatcher()
 	namespaceWatcher, namespaceCh := createFakeWatcher()
+	ingressClassWatcher, _ := createFakeWatcher()
 	client.On("WatchIngresses").Return(ingressWatcher)
 	client.On("WatchServices").Return(serviceWatcher)
 	client.On("WatchNamespaces").Return(namespaceWatcher)
+	client.On("WatchIngressClasses").Return(ingressClassWatcher)
+	if endpoints != nil {
+		endpointsWatcher, _ := createFakeWatcher()
+		client.On("GetEndpoints").Return(endpoints, nil)
+		client.On("WatchEndpoints").Return(endpointsWatcher)
+	}
 
 	//when
 	asserter.NoError(controller.Start())
@@ -1181,7 +1946,7 @@ func runAndAssertUpdates(t *testing.T, clientExpectation clientExpectation, test
 	client.AssertExpectations(t)
 }
 
-func addIngresses(ingresses []*v1beta1.Ingress, entries IngressEntries) IngressEntries {
+func addIngresses(ingresses []*networkingv1.Ingress, entries IngressEntries) IngressEntries {
 	if len(ingresses) != len(entries) {
 		return entries
 	}
@@ -1200,6 +1965,7 @@ func createLbEntriesFixture() IngressEntries {
 		Host:                  ingressHost,
 		Path:                  ingressPath,
 		ServiceAddress:        serviceIP,
+		ServiceName:           ingressSvcName,
 		ServicePort:           ingressSvcPort,
 		Allow:                 strings.Split(ingressAllow, ","),
 		LbScheme:              lbScheme,
@@ -1223,7 +1989,7 @@ const (
 	defaultMaxConnections = 0
 )
 
-func createDefaultIngresses() []*v1beta1.Ingress {
+func createDefaultIngresses() []*networkingv1.Ingress {
 	return createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
 		ingressAllowAnnotation:   ingressAllow,
 		backendTimeoutSeconds:    "10",
@@ -1232,7 +1998,7 @@ func createDefaultIngresses() []*v1beta1.Ingress {
 	}, ingressPath)
 }
 
-func createIngressesFromNonELBAnnotation(legacyAnnotations bool) []*v1beta1.Ingress {
+func createIngressesFromNonELBAnnotation(legacyAnnotations bool) []*networkingv1.Ingress {
 	var timeoutAnnotation, schemeAnnotation string
 	if legacyAnnotations {
 		timeoutAnnotation = legacyBackendKeepaliveSeconds
@@ -1250,8 +2016,8 @@ func createIngressesFromNonELBAnnotation(legacyAnnotations bool) []*v1beta1.Ingr
 	}, ingressPath)
 }
 
-func createIngressWithoutRules() []*v1beta1.Ingress {
-	return []*v1beta1.Ingress{
+func createIngressWithoutRules() []*networkingv1.Ingress {
+	return []*networkingv1.Ingress{
 		{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      ingressName,
@@ -1260,19 +2026,21 @@ func createIngressWithoutRules() []*v1beta1.Ingress {
 					ingressClassAnnotation: defaultIngressClass,
 				},
 			},
-			Spec: v1beta1.IngressSpec{},
+			Spec: networkingv1.IngressSpec{},
 		},
 	}
 
 }
 
-func createIngressesFixture(namespace string, host string, serviceName string, servicePort int, ingressAnnotations map[string]string, path string) []*v1beta1.Ingress {
+func createIngressesFixture(namespace string, host string, serviceName string, servicePort int, ingressAnnotations map[string]string, path string) []*networkingv1.Ingress {
 
-	paths := []v1beta1.HTTPIngressPath{{
+	paths := []networkingv1.HTTPIngressPath{{
 		Path: path,
-		Backend: v1beta1.IngressBackend{
-			ServiceName: serviceName,
-			ServicePort: intstr.FromInt(servicePort),
+		Backend: networkingv1.IngressBackend{
+			Service: &networkingv1.IngressServiceBackend{
+				Name: serviceName,
+				Port: networkingv1.ServiceBackendPort{Number: int32(servicePort)},
+			},
 		},
 	}}
 
@@ -1302,18 +2070,22 @@ func createIngressesFixture(namespace string, host string, serviceName string, s
 			annotations[proxyBufferBlocksAnnotation] = annotationVal
 		case ingressClassAnnotation:
 			annotations[ingressClassAnnotation] = annotationVal
+		case routeToEndpointsAnnotation:
+			annotations[routeToEndpointsAnnotation] = annotationVal
+		case customAnnotation:
+			annotations[customAnnotation] = annotationVal
 		}
 	}
 
 	ingressDefinition := createIngressWithoutRules()
-	var ingressRules []v1beta1.IngressRule
+	var ingressRules []networkingv1.IngressRule
 
 	if host != "" {
-		ingressRuleValue := v1beta1.IngressRuleValue{}
+		ingressRuleValue := networkingv1.IngressRuleValue{}
 		if path != "" {
-			ingressRuleValue.HTTP = &v1beta1.HTTPIngressRuleValue{Paths: paths}
+			ingressRuleValue.HTTP = &networkingv1.HTTPIngressRuleValue{Paths: paths}
 		}
-		ingressRule := v1beta1.IngressRule{
+		ingressRule := networkingv1.IngressRule{
 			Host:             host,
 			IngressRuleValue: ingressRuleValue,
 		}
@@ -1328,6 +2100,55 @@ func createIngressesFixture(namespace string, host string, serviceName string, s
 	return ingressDefinition
 }
 
+func withPathType(ingresses []*networkingv1.Ingress, pathType networkingv1.PathType) []*networkingv1.Ingress {
+	for _, ingress := range ingresses {
+		for _, rule := range ingress.Spec.Rules {
+			if rule.HTTP == nil {
+				continue
+			}
+			for i := range rule.HTTP.Paths {
+				rule.HTTP.Paths[i].PathType = &pathType
+			}
+		}
+	}
+	return ingresses
+}
+
+func withServicePortName(ingresses []*networkingv1.Ingress, portName string) []*networkingv1.Ingress {
+	for _, ingress := range ingresses {
+		for _, rule := range ingress.Spec.Rules {
+			if rule.HTTP == nil {
+				continue
+			}
+			for i := range rule.HTTP.Paths {
+				rule.HTTP.Paths[i].Backend.Service.Port = networkingv1.ServiceBackendPort{Name: portName}
+			}
+		}
+	}
+	return ingresses
+}
+
+func withIngressClassName(ingresses []*networkingv1.Ingress, ingressClassName string) []*networkingv1.Ingress {
+	for _, ingress := range ingresses {
+		ingress.Spec.IngressClassName = &ingressClassName
+	}
+	return ingresses
+}
+
+func createIngressClassFixture(name, controller string, isDefault bool) *networkingv1.IngressClass {
+	return &networkingv1.IngressClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Annotations: map[string]string{
+				defaultIngressClassAnnotation: strconv.FormatBool(isDefault),
+			},
+		},
+		Spec: networkingv1.IngressClassSpec{
+			Controller: controller,
+		},
+	}
+}
+
 func createDefaultServices() []*v1.Service {
 	return createServiceFixture(ingressSvcName, ingressNamespace, serviceIP)
 }
@@ -1346,6 +2167,33 @@ func createServiceFixture(name string, namespace string, clusterIP string) []*v1
 	}
 }
 
+func withServicePort(services []*v1.Service, name string, port int32) []*v1.Service {
+	for _, service := range services {
+		service.Spec.Ports = append(service.Spec.Ports, v1.ServicePort{Name: name, Port: port})
+	}
+	return services
+}
+
+func createEndpointsFixture(name, namespace, portName string, port int32, readyIPs, notReadyIPs []string) *v1.Endpoints {
+	subset := v1.EndpointSubset{
+		Ports: []v1.EndpointPort{{Name: portName, Port: port}},
+	}
+	for _, ip := range readyIPs {
+		subset.Addresses = append(subset.Addresses, v1.EndpointAddress{IP: ip})
+	}
+	for _, ip := range notReadyIPs {
+		subset.NotReadyAddresses = append(subset.NotReadyAddresses, v1.EndpointAddress{IP: ip})
+	}
+
+	return &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Subsets: []v1.EndpointSubset{subset},
+	}
+}
+
 func createDefaultNamespaces() []*v1.Namespace {
 	return createNamespaceFixture(ingressNamespace, map[string]string{})
 }
@@ -1394,14 +2242,16 @@ func TestUpdateFailsWhenK8sClientReturnsNoIngresses(t *testing.T) {
 	updater.On("Health").Return(nil)
 
 	// This is the call we are testing (by returning an empty array of ingresses)
-	client.On("GetAllIngresses").Return([]*v1beta1.Ingress{}, nil)
+	client.On("GetAllIngresses").Return([]*networkingv1.Ingress{}, nil)
 
 	ingressWatcher, ingressCh := createFakeWatcher()
 	serviceWatcher, serviceCh := createFakeWatcher()
 	namespaceWatcher, namespaceCh := createFakeWatcher()
+	ingressClassWatcher, _ := createFakeWatcher()
 	client.On("WatchIngresses").Return(ingressWatcher)
 	client.On("WatchServices").Return(serviceWatcher)
 	client.On("WatchNamespaces").Return(namespaceWatcher)
+	client.On("WatchIngressClasses").Return(ingressClassWatcher)
 
 	asserter.NoError(controller.Start())
 	ingressCh <- struct{}{}
@@ -1455,14 +2305,16 @@ func TestUpdateFailsWhenK8sClientReturnsNoNamespaceIngresses(t *testing.T) {
 	updater.On("Health").Return(nil)
 
 	// This is the call we are testing (by returning an empty array of ingresses)
-	client.On("GetIngresses", namespaceSelector).Return([]*v1beta1.Ingress{}, nil)
+	client.On("GetIngresses", namespaceSelector).Return([]*networkingv1.Ingress{}, nil)
 
 	ingressWatcher, ingressCh := createFakeWatcher()
 	serviceWatcher, serviceCh := createFakeWatcher()
 	namespaceWatcher, namespaceCh := createFakeWatcher()
+	ingressClassWatcher, _ := createFakeWatcher()
 	client.On("WatchIngresses").Return(ingressWatcher)
 	client.On("WatchServices").Return(serviceWatcher)
 	client.On("WatchNamespaces").Return(namespaceWatcher)
+	client.On("WatchIngressClasses").Return(ingressClassWatcher)
 
 	asserter.NoError(controller.Start())
 	ingressCh <- struct{}{}
@@ -1516,9 +2368,11 @@ func TestUpdateFailsWhenK8sClientReturnsNoServices(t *testing.T) {
 	ingressWatcher, ingressCh := createFakeWatcher()
 	serviceWatcher, serviceCh := createFakeWatcher()
 	namespaceWatcher, namespaceCh := createFakeWatcher()
+	ingressClassWatcher, _ := createFakeWatcher()
 	client.On("WatchIngresses").Return(ingressWatcher)
 	client.On("WatchServices").Return(serviceWatcher)
 	client.On("WatchNamespaces").Return(namespaceWatcher)
+	client.On("WatchIngressClasses").Return(ingressClassWatcher)
 
 	asserter.NoError(controller.Start())
 	ingressCh <- struct{}{}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// IngressEntriesDelta describes how ingress entries changed between two updates. Entries are
+// identified by their ingress namespace, name, host and path.
+type IngressEntriesDelta struct {
+	// Added entries are new since the previous update.
+	Added IngressEntries
+	// Removed entries were in the previous update, but are gone now.
+	Removed IngressEntries
+	// Changed entries are the new versions of entries whose fields changed since the previous update.
+	Changed IngressEntries
+}
+
+// Empty returns true if no entries changed.
+func (d IngressEntriesDelta) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+func (d IngressEntriesDelta) String() string {
+	return fmt.Sprintf("%d added, %d removed and %d changed entries", len(d.Added), len(d.Removed), len(d.Changed))
+}
+
+type entryKey struct {
+	namespace, name, host, path string
+}
+
+func keyOf(e IngressEntry) entryKey {
+	return entryKey{namespace: e.Namespace, name: e.Name, host: e.Host, path: e.Path}
+}
+
+// diffIngressEntries computes the delta from previous to current entries.
+func diffIngressEntries(previous, current IngressEntries) IngressEntriesDelta {
+	previousByKey := make(map[entryKey]IngressEntry, len(previous))
+	for _, e := range previous {
+		previousByKey[keyOf(e)] = e
+	}
+
+	var delta IngressEntriesDelta
+	currentKeys := make(map[entryKey]bool, len(current))
+	for _, e := range current {
+		key := keyOf(e)
+		currentKeys[key] = true
+		if p, ok := previousByKey[key]; !ok {
+			delta.Added = append(delta.Added, e)
+		} else if !SameEntry(p, e) {
+			delta.Changed = append(delta.Changed, e)
+		}
+	}
+	for _, e := range previous {
+		if !currentKeys[keyOf(e)] {
+			delta.Removed = append(delta.Removed, e)
+		}
+	}
+	return delta
+}
+
+// SameEntry compares entries without their Ingress, which changes whenever the ingress resource is
+// written to, such as by status updates, even if nothing used by the entry changed.
+func SameEntry(a, b IngressEntry) bool {
+	a.Ingress = nil
+	b.Ingress = nil
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+func TestDiffIngressEntries(t *testing.T) {
+	asserter := assert.New(t)
+	unchanged := IngressEntry{Namespace: "ns", Name: "a", Host: "a.com", Path: "/", ServicePort: 80}
+	changed := IngressEntry{Namespace: "ns", Name: "b", Host: "b.com", Path: "/", ServicePort: 80}
+	removed := IngressEntry{Namespace: "ns", Name: "c", Host: "c.com", Path: "/", ServicePort: 80}
+	added := IngressEntry{Namespace: "ns", Name: "d", Host: "d.com", Path: "/", ServicePort: 80}
+
+	updatedIngress := unchanged
+	updatedIngress.Ingress = &networkingv1.Ingress{}
+	updatedChanged := changed
+	updatedChanged.ServicePort = 8080
+
+	delta := diffIngressEntries(
+		IngressEntries{unchanged, changed, removed},
+		IngressEntries{added, updatedChanged, updatedIngress},
+	)
+
+	asserter.Equal(IngressEntries{added}, delta.Added)
+	asserter.Equal(IngressEntries{removed}, delta.Removed)
+	asserter.Equal(IngressEntries{updatedChanged}, delta.Changed)
+	asserter.False(delta.Empty())
+	asserter.Equal("1 added, 1 removed and 1 changed entries", delta.String())
+}
+
+func TestDiffIngressEntriesWithoutChanges(t *testing.T) {
+	asserter := assert.New(t)
+	entries := IngressEntries{{Namespace: "ns", Name: "a", Host: "a.com", Path: "/", ServicePort: 80}}
+
+	asserter.True(diffIngressEntries(entries, entries).Empty())
+	asserter.True(diffIngressEntries(nil, nil).Empty())
+	asserter.Equal(entries, diffIngressEntries(nil, entries).Added)
+}
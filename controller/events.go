@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// Reasons of the events recorded on ingress resources.
+const (
+	serviceNotFoundReason   = "ServiceNotFound"
+	missingHTTPRuleReason   = "MissingHTTPRule"
+	invalidIngressReason    = "InvalidIngress"
+	invalidAnnotationReason = "InvalidAnnotation"
+	tlsSecretNotFoundReason = "TLSSecretNotFound"
+	invalidTLSSecretReason  = "InvalidTLSSecret"
+)
+
+// Every update re-evaluates all ingresses, so the same event is repeated at most this often.
+const eventRepeatInterval = time.Hour
+
+type eventKey struct {
+	namespace string
+	name      string
+	eventType string
+	reason    string
+	message   string
+}
+
+// ingressEvents records events on ingress resources, dropping repeats of an event within repeatInterval.
+// The recorder is expected to rate limit events further. Not safe for concurrent use.
+type ingressEvents struct {
+	recorder       record.EventRecorder
+	repeatInterval time.Duration
+	lastRecorded   map[eventKey]time.Time
+	now            func() time.Time
+}
+
+func newIngressEvents(recorder record.EventRecorder) *ingressEvents {
+	return &ingressEvents{
+		recorder:       recorder,
+		repeatInterval: eventRepeatInterval,
+		lastRecorded:   make(map[eventKey]time.Time),
+		now:            time.Now,
+	}
+}
+
+func (e *ingressEvents) record(ingress *networkingv1.Ingress, eventType, reason, message string) {
+	if e.recorder == nil {
+		return
+	}
+
+	key := eventKey{namespace: ingress.Namespace, name: ingress.Name, eventType: eventType, reason: reason, message: message}
+	now := e.now()
+	if last, ok := e.lastRecorded[key]; ok && now.Sub(last) < e.repeatInterval {
+		return
+	}
+
+	e.lastRecorded[key] = now
+	e.recorder.Event(ingress, eventType, reason, message)
+}
+
+// expire forgets events which are old enough to be recorded again, so deleted ingresses aren't kept forever.
+func (e *ingressEvents) expire() {
+	now := e.now()
+	for key, last := range e.lastRecorded {
+		if now.Sub(last) >= e.repeatInterval {
+			delete(e.lastRecorded, key)
+		}
+	}
+}
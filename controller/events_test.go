@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestIngressEventsAreDeduplicatedUntilRepeatInterval(t *testing.T) {
+	asserter := assert.New(t)
+	recorder := record.NewFakeRecorder(10)
+	events := newIngressEvents(recorder)
+	now := time.Now()
+	events.now = func() time.Time { return now }
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "core", Name: "ingress"}}
+
+	events.record(ingress, v1.EventTypeWarning, serviceNotFoundReason, "service foo doesn't exist")
+	events.record(ingress, v1.EventTypeWarning, serviceNotFoundReason, "service foo doesn't exist")
+	events.record(ingress, v1.EventTypeWarning, serviceNotFoundReason, "service bar doesn't exist")
+	asserter.Equal("Warning ServiceNotFound service foo doesn't exist", <-recorder.Events)
+	asserter.Equal("Warning ServiceNotFound service bar doesn't exist", <-recorder.Events)
+	asserter.Empty(recorder.Events)
+
+	now = now.Add(eventRepeatInterval)
+	events.record(ingress, v1.EventTypeWarning, serviceNotFoundReason, "service foo doesn't exist")
+	asserter.Equal("Warning ServiceNotFound service foo doesn't exist", <-recorder.Events)
+}
+
+func TestIngressEventsExpireOldEvents(t *testing.T) {
+	asserter := assert.New(t)
+	events := newIngressEvents(record.NewFakeRecorder(10))
+	now := time.Now()
+	events.now = func() time.Time { return now }
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "core", Name: "ingress"}}
+
+	events.record(ingress, v1.EventTypeWarning, serviceNotFoundReason, "service foo doesn't exist")
+	events.expire()
+	asserter.Len(events.lastRecorded, 1)
+
+	now = now.Add(eventRepeatInterval)
+	events.expire()
+	asserter.Empty(events.lastRecorded)
+}
+
+func TestIngressEventsWithoutRecorderAreDropped(t *testing.T) {
+	events := newIngressEvents(nil)
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "core", Name: "ingress"}}
+
+	events.record(ingress, v1.EventTypeWarning, serviceNotFoundReason, "service foo doesn't exist")
+
+	assert.Empty(t, events.lastRecorded)
+}
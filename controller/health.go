@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+)
+
+// Statuses of an updater in a HealthReport.
+const (
+	// UpdaterHealthy means the updater is healthy, and its last update succeeded.
+	UpdaterHealthy = "healthy"
+	// UpdaterFailing means the updater is healthy, but its last update failed and is being retried.
+	UpdaterFailing = "failing"
+	// UpdaterUnhealthy means the updater itself is unhealthy, such as nginx not running.
+	UpdaterUnhealthy = "unhealthy"
+)
+
+const usingSnapshot = "using the last known good snapshot until ingresses are synced"
+
+// HealthReport describes the health of the controller and each of its updaters.
+type HealthReport struct {
+	// Alive is true if the controller is started and every updater is healthy, even if updates are failing.
+	// Restarting won't fix failing updates, such as an unavailable AWS API.
+	Alive bool `json:"alive"`
+	// Ready is true if the controller is alive, and the latest updates were applied by every updater.
+	Ready bool `json:"ready"`
+	// Degraded is true while updaters use the entries of the last known good snapshot, until ingresses are synced.
+	Degraded bool `json:"degraded"`
+	// Error explains why the controller isn't ready, if not caused by a single updater.
+	Error    string          `json:"error,omitempty"`
+	Updaters []UpdaterHealth `json:"updaters"`
+}
+
+// UpdaterHealth describes the health of a single updater.
+type UpdaterHealth struct {
+	Name string `json:"name"`
+	// Status is one of UpdaterHealthy, UpdaterFailing or UpdaterUnhealthy.
+	Status string `json:"status"`
+	// Error is returned by the Health of the updater.
+	Error                string     `json:"error,omitempty"`
+	LastSuccessfulUpdate *time.Time `json:"lastSuccessfulUpdate,omitempty"`
+	LastUpdateError      string     `json:"lastUpdateError,omitempty"`
+	ConsecutiveFailures  int        `json:"consecutiveFailures"`
+}
+
+func (c *controller) HealthReport() HealthReport {
+	c.Lock()
+	defer c.Unlock()
+
+	report := HealthReport{Updaters: []UpdaterHealth{}}
+	if !c.started {
+		report.Error = "controller has not started"
+		return report
+	}
+
+	report.Alive = true
+	report.Ready = true
+	if err := c.updatesHealth.entriesErr(); err != nil {
+		report.Ready = false
+		report.Error = fmt.Sprintf("updates failed to apply: %v", err)
+	}
+	if c.degraded.Get() {
+		report.Degraded = true
+		report.Ready = false
+		if report.Error == "" {
+			report.Error = usingSnapshot
+		}
+	}
+
+	for i, u := range c.updaters {
+		updater := c.updatesHealth.report(i)
+		updater.Name = updaterName(u)
+		updater.Status = UpdaterHealthy
+		if updater.LastUpdateError != "" {
+			updater.Status = UpdaterFailing
+			report.Ready = false
+		}
+		if err := u.Health(); err != nil {
+			updater.Status = UpdaterUnhealthy
+			updater.Error = err.Error()
+			report.Alive = false
+			report.Ready = false
+		}
+		report.Updaters = append(report.Updaters, updater)
+	}
+
+	return report
+}
+
+func updaterName(u Updater) string {
+	if s, ok := u.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", u)
+}
@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	fake "github.com/sky-uk/feed/util/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+func TestHealthReportIsNotAliveUntilStarted(t *testing.T) {
+	asserter := assert.New(t)
+	updater, client := createDefaultStubs()
+	controller := newController(updater, client)
+
+	report := controller.HealthReport()
+
+	asserter.False(report.Alive)
+	asserter.False(report.Ready)
+	asserter.Equal("controller has not started", report.Error)
+}
+
+func TestHealthReportDescribesEachUpdater(t *testing.T) {
+	// given
+	asserter := assert.New(t)
+	failingUpdater := new(fakeUpdater)
+	updater := new(fakeUpdater)
+	client := new(fake.FakeClient)
+	config := defaultConfig()
+	config.KubernetesClient = client
+	config.Updaters = []Updater{failingUpdater, updater}
+	config.UpdateRetryInitialBackoff = time.Hour
+	controller := New(config)
+
+	ingressWatcher, updateCh := createFakeWatcher()
+	serviceWatcher, _ := createFakeWatcher()
+	namespaceWatcher, _ := createFakeWatcher()
+	ingressClassWatcher, _ := createFakeWatcher()
+
+	for _, u := range []*fakeUpdater{failingUpdater, updater} {
+		u.On("Start").Return(nil)
+		u.On("Stop").Return(nil)
+	}
+	failingUpdater.On("Update", mock.Anything).Return(errors.New("kaboom"))
+	failingUpdater.On("Health").Return(nil)
+	updater.On("Update", mock.Anything).Return(nil)
+	updater.On("Health").Return(nil).Once()
+	updater.On("Health").Return(errors.New("dead"))
+
+	client.On("GetAllIngresses").Return(createDefaultIngresses(), nil)
+	client.On("GetServices").Return(createDefaultServices(), nil)
+	client.On("GetIngressClasses").Return([]*networkingv1.IngressClass{}, nil)
+	client.On("WatchIngresses").Return(ingressWatcher)
+	client.On("WatchServices").Return(serviceWatcher)
+	client.On("WatchNamespaces").Return(namespaceWatcher)
+	client.On("WatchIngressClasses").Return(ingressClassWatcher)
+	asserter.NoError(controller.Start())
+	before := time.Now()
+
+	// when
+	updateCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+	report := controller.HealthReport()
+
+	// then
+	asserter.True(report.Alive, "failing updates shouldn't affect liveness")
+	asserter.False(report.Ready)
+	asserter.Empty(report.Error)
+	if asserter.Len(report.Updaters, 2) {
+		failing := report.Updaters[0]
+		asserter.Equal("FakeUpdater", failing.Name)
+		asserter.Equal(UpdaterFailing, failing.Status)
+		asserter.Equal("kaboom", failing.LastUpdateError)
+		asserter.Equal(1, failing.ConsecutiveFailures)
+		asserter.Nil(failing.LastSuccessfulUpdate)
+
+		healthy := report.Updaters[1]
+		asserter.Equal(UpdaterHealthy, healthy.Status)
+		asserter.Empty(healthy.LastUpdateError)
+		asserter.Zero(healthy.ConsecutiveFailures)
+		if asserter.NotNil(healthy.LastSuccessfulUpdate) {
+			asserter.False(healthy.LastSuccessfulUpdate.Before(before))
+		}
+	}
+
+	// and an unhealthy updater isn't alive
+	report = controller.HealthReport()
+	asserter.False(report.Alive)
+	asserter.Equal(UpdaterUnhealthy, report.Updaters[1].Status)
+	asserter.Equal("dead", report.Updaters[1].Error)
+
+	// cleanup
+	_ = controller.Stop()
+}
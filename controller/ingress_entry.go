@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"time"
 
-	"k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
 )
 
 // IngressEntries type
@@ -13,7 +13,8 @@ type IngressEntries []IngressEntry
 
 // IngressEntry describes the ingress for a single host, path, and service.
 type IngressEntry struct {
-	// The name of the feed-ingress instance that will manage the ingress resource.
+	// The ingress class requested by the ingress resource, either with spec.ingressClassName or
+	// the kubernetes.io/ingress.class annotation.
 	IngressClass string
 	// Namespace of the ingress.
 	Namespace string
@@ -24,10 +25,17 @@ type IngressEntry struct {
 	// Path is the url path after the hostname. Must be non-empty.
 	Path string
 	// ServiceAddress is a routable address for the Kubernetes backend service to proxy traffic to.
-	// Must be non-empty.
+	// Must be non-empty, unless RouteToEndpoints is set.
 	ServiceAddress string
+	// ServiceName is the name of the Kubernetes backend service.
+	ServiceName string
 	// ServicePort is the port to proxy traffic to. Must be non-zero.
 	ServicePort int32
+	// RouteToEndpoints proxies traffic directly to the ready Endpoints of the service,
+	// rather than to the ServiceAddress.
+	RouteToEndpoints bool
+	// Endpoints are the ready pod addresses of the service. Must be non-empty when RouteToEndpoints is set.
+	Endpoints []Endpoint
 	// Allow are the ips or CIDRs that are allowed to access the service.
 	Allow []string
 	// LbScheme internet-facing or internal will dictate which kind of load balancer to attach to.
@@ -43,11 +51,58 @@ type IngressEntry struct {
 	// Ingress creation time
 	CreationTimestamp time.Time
 	// Ingress resource
-	Ingress *v1beta1.Ingress
+	Ingress *networkingv1.Ingress
 	// Size of the buffer used for reading the first part of the response received from the proxied server.
 	ProxyBufferSize int
 	// Number of buffers used for reading a response from the proxied server, for a single connection.
 	ProxyBufferBlocks int
+	// TLSCertificate for the Host, from the Secret the ingress lists the Host under in spec.tls.
+	// Nil if there is no such Secret, in which case updaters should use their default certificate.
+	TLSCertificate *TLSCertificate
+	// TLSProfile is the name of the TLS settings of the Host's https port. Empty for the updater's default.
+	TLSProfile string
+	// HTTPSRedirect redirects plain http requests to https with HTTPSRedirectCode, 301 or 308. A code of 0 is
+	// left to the updater.
+	HTTPSRedirect     bool
+	HTTPSRedirectCode int
+	// HSTS adds a Strict-Transport-Security header with the max-age, includeSubDomains and preload directives
+	// to https responses.
+	HSTS                  bool
+	HSTSMaxAgeSeconds     int
+	HSTSIncludeSubDomains bool
+	HSTSPreload           bool
+	// RateLimit is the request rate allowed of each client, in requests per second or minute such as 10r/s or
+	// 600r/m. Clients are identified by RateLimitHeader, or by their IP if it is empty or they don't send it.
+	// Empty for no limit.
+	RateLimit       string
+	RateLimitBurst  int
+	RateLimitHeader string
+	// Attributes are set by custom annotation handlers, for use by updaters and the nginx template.
+	// Keys should be namespaced like annotations, such as example.com/my-attribute, to avoid clashes.
+	Attributes map[string]interface{}
+}
+
+// SetAttribute sets an attribute of the entry, creating the Attributes map if needed.
+func (e *IngressEntry) SetAttribute(key string, value interface{}) {
+	if e.Attributes == nil {
+		e.Attributes = make(map[string]interface{})
+	}
+	e.Attributes[key] = value
+}
+
+// TLSCertificate is a PEM encoded certificate chain and private key, read from a kubernetes.io/tls Secret.
+type TLSCertificate struct {
+	// SecretNamespace and SecretName identify the Secret the certificate was read from.
+	SecretNamespace string
+	SecretName      string
+	Certificate     []byte
+	Key             []byte
+}
+
+// Endpoint is the address and port of a single ready pod backing a service.
+type Endpoint struct {
+	Address string
+	Port    int32
 }
 
 // validate returns error if entry has invalid fields.
@@ -55,11 +110,17 @@ func (e IngressEntry) validate() error {
 	if e.Host == "" {
 		return errors.New("missing host")
 	}
-	if e.ServiceAddress == "" {
-		return errors.New("missing service address")
-	}
-	if e.ServiceAddress == "None" {
-		return errors.New("service address is set to 'None'")
+	if e.RouteToEndpoints {
+		if len(e.Endpoints) == 0 {
+			return errors.New("no ready endpoints")
+		}
+	} else {
+		if e.ServiceAddress == "" {
+			return errors.New("missing service address")
+		}
+		if e.ServiceAddress == "None" {
+			return errors.New("service address is set to 'None'")
+		}
 	}
 	if e.ServicePort == 0 {
 		return errors.New("missing service port")
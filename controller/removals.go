@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/util"
+)
+
+// Defaults of Config.MaxRemovedEntries and Config.MaxRemovedEntriesPercent, which disable the removal threshold.
+const (
+	DefaultMaxRemovedEntries        = 0
+	DefaultMaxRemovedEntriesPercent = 0
+)
+
+// removalGuard refuses updates which remove too many of the entries of the previous update. A bad RBAC change
+// or namespace selector can make most ingresses disappear at once, which would otherwise remove their routes
+// and DNS records.
+type removalGuard struct {
+	// maxRemoved and maxRemovedPercent are disabled if 0.
+	maxRemoved        int
+	maxRemovedPercent int
+	// previous are the entries of the last accepted update.
+	previous IngressEntries
+	// overridden allows the next update, however many entries it removes.
+	overridden util.SafeBool
+}
+
+// check returns an error if the entries remove more than allowed of the previous entries. Otherwise they
+// become the entries later updates are compared to.
+func (g *removalGuard) check(entries IngressEntries) error {
+	removed := len(diffIngressEntries(g.previous, entries).Removed)
+	if g.exceeded(removed) {
+		if !g.overridden.Get() {
+			blockedRemovalsGauge.Set(float64(removed))
+			return fmt.Errorf("refusing to remove %d of %d ingress entries, which exceeds the removal threshold",
+				removed, len(g.previous))
+		}
+		log.Warnf("Removing %d of %d ingress entries, as the removal threshold was overridden", removed, len(g.previous))
+	}
+
+	g.overridden.Set(false)
+	blockedRemovalsGauge.Set(0)
+	g.previous = entries
+	return nil
+}
+
+func (g *removalGuard) exceeded(removed int) bool {
+	if removed == 0 {
+		return false
+	}
+	if g.maxRemoved > 0 && removed > g.maxRemoved {
+		return true
+	}
+	return g.maxRemovedPercent > 0 && removed*100 > g.maxRemovedPercent*len(g.previous)
+}
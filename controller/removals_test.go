@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	fake "github.com/sky-uk/feed/util/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+func TestRemovalGuardRefusesUpdatesWhichRemoveTooManyEntries(t *testing.T) {
+	initMetrics("ingress")
+	previous := IngressEntries{{Host: "a"}, {Host: "b"}, {Host: "c"}, {Host: "d"}}
+
+	var tests = []struct {
+		description       string
+		maxRemoved        int
+		maxRemovedPercent int
+		entries           IngressEntries
+		refused           bool
+	}{
+		{"disabled", 0, 0, IngressEntries{{Host: "a"}}, false},
+		{"below max removed", 2, 0, IngressEntries{{Host: "a"}, {Host: "b"}}, false},
+		{"above max removed", 2, 0, IngressEntries{{Host: "a"}}, true},
+		{"below max removed percent", 0, 50, IngressEntries{{Host: "a"}, {Host: "b"}}, false},
+		{"above max removed percent", 0, 50, IngressEntries{{Host: "a"}}, true},
+		{"added entries aren't removals", 1, 0, IngressEntries{{Host: "a"}, {Host: "b"}, {Host: "c"}, {Host: "e"}, {Host: "f"}}, false},
+		{"changed entries aren't removals", 1, 0, IngressEntries{{Host: "a", ServiceName: "foo"}, {Host: "b"}, {Host: "c"}, {Host: "d"}}, false},
+	}
+
+	for _, test := range tests {
+		guard := &removalGuard{maxRemoved: test.maxRemoved, maxRemovedPercent: test.maxRemovedPercent, previous: previous}
+		err := guard.check(test.entries)
+		if test.refused {
+			assert.Error(t, err, test.description)
+			assert.Equal(t, previous, guard.previous, test.description)
+		} else {
+			assert.NoError(t, err, test.description)
+			assert.Equal(t, test.entries, guard.previous, test.description)
+		}
+	}
+}
+
+func TestRemovalGuardAllowsFirstUpdate(t *testing.T) {
+	initMetrics("ingress")
+	guard := &removalGuard{maxRemoved: 1}
+
+	assert.NoError(t, guard.check(createLbEntriesFixture()))
+}
+
+func TestRemovalGuardCanBeOverriddenForOneUpdate(t *testing.T) {
+	asserter := assert.New(t)
+	initMetrics("ingress")
+	guard := &removalGuard{maxRemoved: 1, previous: IngressEntries{{Host: "a"}, {Host: "b"}, {Host: "c"}}}
+
+	asserter.EqualError(guard.check(IngressEntries{{Host: "a"}}),
+		"refusing to remove 2 of 3 ingress entries, which exceeds the removal threshold")
+	asserter.Equal(2.0, metricValue(t, blockedRemovalsGauge))
+
+	guard.overridden.Set(true)
+	asserter.NoError(guard.check(IngressEntries{{Host: "a"}}))
+	asserter.Equal(0.0, metricValue(t, blockedRemovalsGauge))
+	asserter.False(guard.overridden.Get())
+
+	guard.previous = IngressEntries{{Host: "a"}, {Host: "b"}, {Host: "c"}}
+	asserter.Error(guard.check(IngressEntries{{Host: "a"}}))
+}
+
+func TestControllerRefusesUpdateWhichRemovesTooManyEntriesUntilOverridden(t *testing.T) {
+	// given
+	asserter := assert.New(t)
+	updater := new(fakeUpdater)
+	client := new(fake.FakeClient)
+	config := defaultConfig()
+	config.KubernetesClient = client
+	config.Updaters = []Updater{updater}
+	config.MaxRemovedEntriesPercent = 40
+	controller := New(config)
+
+	ingressWatcher, updateCh := createFakeWatcher()
+	serviceWatcher, _ := createFakeWatcher()
+	namespaceWatcher, _ := createFakeWatcher()
+	ingressClassWatcher, _ := createFakeWatcher()
+
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Health").Return(nil)
+	updater.On("Update", mock.Anything).Return(nil)
+
+	ingresses := createDefaultIngresses()
+	otherIngress := createDefaultIngresses()[0].DeepCopy()
+	otherIngress.Spec.Rules[0].Host = "bar.sky.com"
+	client.On("GetAllIngresses").Return(append(ingresses, otherIngress), nil).Once()
+	client.On("GetAllIngresses").Return(ingresses, nil)
+	client.On("GetServices").Return(createDefaultServices(), nil)
+	client.On("GetIngressClasses").Return([]*networkingv1.IngressClass{}, nil)
+	client.On("WatchIngresses").Return(ingressWatcher)
+	client.On("WatchServices").Return(serviceWatcher)
+	client.On("WatchNamespaces").Return(namespaceWatcher)
+	client.On("WatchIngressClasses").Return(ingressClassWatcher)
+	asserter.NoError(controller.Start())
+
+	// when
+	updateCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+	updateCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+
+	// then
+	updater.AssertNumberOfCalls(t, "Update", 1)
+	asserter.EqualError(controller.Health(),
+		"updates failed to apply: refusing to remove 1 of 2 ingress entries, which exceeds the removal threshold")
+	report := controller.HealthReport()
+	asserter.True(report.Alive)
+	asserter.False(report.Ready)
+	asserter.Equal(1.0, metricValue(t, blockedRemovalsGauge))
+
+	// and the update is applied once overridden
+	controller.OverrideRemovalThreshold()
+	time.Sleep(smallWaitTime)
+	updater.AssertNumberOfCalls(t, "Update", 2)
+	asserter.NoError(controller.Health())
+	asserter.Equal(0.0, metricValue(t, blockedRemovalsGauge))
+
+	// cleanup
+	_ = controller.Stop()
+}
+
+func metricValue(t *testing.T, m prometheus.Metric) float64 {
+	var metric dto.Metric
+	assert.NoError(t, m.Write(&metric))
+	if metric.Counter != nil {
+		return metric.GetCounter().GetValue()
+	}
+	return metric.GetGauge().GetValue()
+}
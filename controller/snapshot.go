@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+)
+
+// snapshot holds the last ingress entries applied by every updater. It lets updaters be started from
+// the last known good entries if the API server can't be reached on startup.
+type snapshot struct {
+	Entries []snapshotEntry `json:"entries"`
+}
+
+// snapshotEntry is an entry with attributes which keep their types when loaded.
+type snapshotEntry struct {
+	IngressEntry
+	Attributes map[string]snapshotAttribute `json:",omitempty"`
+}
+
+// snapshotAttribute is an attribute value with its type, as JSON can't tell an int from a float64.
+type snapshotAttribute struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// saveSnapshot writes the entries to file, replacing it atomically so a partially written snapshot is never loaded.
+// TLS certificates aren't saved, so private keys are never written to the snapshot, and restored entries use the
+// default certificate until ingresses are synced. Entries with attributes of other types than string, bool, int,
+// int64, float64 and []string are left out, as they can't be restored with the same types.
+// It returns the number of entries saved.
+func saveSnapshot(file string, entries IngressEntries) (int, error) {
+	var s snapshot
+	for _, e := range entries {
+		attributes, ok := snapshotAttributes(e.Attributes)
+		if !ok {
+			continue
+		}
+		if e.Ingress != nil {
+			// Managed fields are only used for server side apply, and can be larger than the rest of the ingress.
+			e.Ingress = e.Ingress.DeepCopy()
+			e.Ingress.ManagedFields = nil
+		}
+		e.Attributes = nil
+		e.TLSCertificate = nil
+		s.Entries = append(s.Entries, snapshotEntry{IngressEntry: e, Attributes: attributes})
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return 0, err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	return len(s.Entries), os.Rename(tmp.Name(), file)
+}
+
+func loadSnapshot(file string) (IngressEntries, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	entries := make(IngressEntries, len(s.Entries))
+	for i, se := range s.Entries {
+		entry := se.IngressEntry
+		for key, attribute := range se.Attributes {
+			value, err := attribute.decode()
+			if err != nil {
+				return nil, fmt.Errorf("attribute %s of %s: %v", key, entry.Name, err)
+			}
+			entry.SetAttribute(key, value)
+		}
+		entries[i] = entry
+	}
+	return entries, nil
+}
+
+// snapshotAttributeTypes are the attribute types which can be saved to the snapshot, by name.
+var snapshotAttributeTypes = map[string]reflect.Type{
+	"string":   reflect.TypeOf(""),
+	"bool":     reflect.TypeOf(false),
+	"int":      reflect.TypeOf(0),
+	"int64":    reflect.TypeOf(int64(0)),
+	"float64":  reflect.TypeOf(float64(0)),
+	"[]string": reflect.TypeOf([]string(nil)),
+}
+
+// snapshotAttributes returns the attributes with their types, or false if any has an unsupported type.
+func snapshotAttributes(attributes map[string]interface{}) (map[string]snapshotAttribute, bool) {
+	if len(attributes) == 0 {
+		return nil, true
+	}
+	typed := make(map[string]snapshotAttribute, len(attributes))
+	for key, value := range attributes {
+		t := reflect.TypeOf(value)
+		if t == nil || snapshotAttributeTypes[t.String()] != t {
+			return nil, false
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, false
+		}
+		typed[key] = snapshotAttribute{Type: t.String(), Value: data}
+	}
+	return typed, true
+}
+
+func (a snapshotAttribute) decode() (interface{}, error) {
+	t, ok := snapshotAttributeTypes[a.Type]
+	if !ok {
+		return nil, fmt.Errorf("unsupported type %q", a.Type)
+	}
+	value := reflect.New(t)
+	if err := json.Unmarshal(a.Value, value.Interface()); err != nil {
+		return nil, err
+	}
+	return value.Elem().Interface(), nil
+}
@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	fake "github.com/sky-uk/feed/util/test"
+	"github.com/stretchr/testify/assert"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSnapshotCanBeSavedAndLoaded(t *testing.T) {
+	asserter := assert.New(t)
+	dir, err := ioutil.TempDir("", "snapshot")
+	asserter.NoError(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "snapshot.json")
+
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{
+		Namespace:     ingressNamespace,
+		Name:          ingressName,
+		ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "kubectl"}},
+	}}
+	entries := createLbEntriesFixture()
+	entries[0].Ingress = ingress
+	entries[0].Endpoints = []Endpoint{{Address: "10.2.0.1", Port: 8080}}
+	entries[0].SetAttribute("example.com/team", "ingress")
+	entries[0].SetAttribute("example.com/weight", 3)
+	entries[0].SetAttribute("example.com/owners", []string{"a", "b"})
+
+	saved, err := saveSnapshot(file, entries)
+	asserter.NoError(err)
+	asserter.Equal(1, saved)
+	loaded, err := loadSnapshot(file)
+	asserter.NoError(err)
+
+	asserter.Len(ingress.ManagedFields, 1, "should not modify the saved entries")
+	expected := entries[0]
+	expected.Ingress = ingress.DeepCopy()
+	expected.Ingress.ManagedFields = nil
+	asserter.Equal(IngressEntries{expected}, loaded)
+
+	files, err := ioutil.ReadDir(dir)
+	asserter.NoError(err)
+	asserter.Len(files, 1, "should not leave temporary files")
+}
+
+func TestTLSEntriesAreRestoredWithoutTheirCertificates(t *testing.T) {
+	asserter := assert.New(t)
+	dir, err := ioutil.TempDir("", "snapshot")
+	asserter.NoError(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "snapshot.json")
+
+	tlsEntry := func(path string) IngressEntry {
+		return IngressEntry{Namespace: ingressNamespace, Name: "tls", Host: ingressHost, Path: path,
+			TLSCertificate: &TLSCertificate{
+				SecretNamespace: ingressNamespace, SecretName: "tls", Certificate: []byte("cert"), Key: []byte("private-key"),
+			}}
+	}
+	entries := IngressEntries{tlsEntry("/a"), tlsEntry("/b")}
+
+	saved, err := saveSnapshot(file, entries)
+	asserter.NoError(err)
+	asserter.Equal(2, saved)
+
+	data, err := ioutil.ReadFile(file)
+	asserter.NoError(err)
+	asserter.NotContains(string(data), "private-key")
+
+	loaded, err := loadSnapshot(file)
+	asserter.NoError(err)
+	if asserter.Len(loaded, 2) {
+		for i, entry := range loaded {
+			asserter.Equal(ingressHost, entry.Host)
+			asserter.Equal(entries[i].Path, entry.Path)
+			asserter.Nil(entry.TLSCertificate, "should use the default certificate")
+		}
+	}
+	asserter.NotNil(entries[0].TLSCertificate, "should not modify the saved entries")
+}
+
+func TestEntriesWithUnsupportedAttributesAreNotSaved(t *testing.T) {
+	asserter := assert.New(t)
+	dir, err := ioutil.TempDir("", "snapshot")
+	asserter.NoError(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "snapshot.json")
+
+	entries := IngressEntries{
+		{Namespace: ingressNamespace, Name: "plain", Host: ingressHost, Path: "/plain"},
+		{Namespace: ingressNamespace, Name: "struct", Host: ingressHost, Path: "/struct"},
+	}
+	entries[1].SetAttribute("example.com/endpoint", Endpoint{Address: "10.2.0.1"})
+
+	saved, err := saveSnapshot(file, entries)
+	asserter.NoError(err)
+	asserter.Equal(1, saved)
+
+	loaded, err := loadSnapshot(file)
+	asserter.NoError(err)
+	asserter.Equal(entries[:1], loaded)
+}
+
+func TestLoadingMissingSnapshotFails(t *testing.T) {
+	_, err := loadSnapshot("/does/not/exist.json")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUpdatersAreUpdatedFromSnapshotUntilIngressesAreSynced(t *testing.T) {
+	// given
+	asserter := assert.New(t)
+	dir, err := ioutil.TempDir("", "snapshot")
+	asserter.NoError(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "snapshot.json")
+
+	snapshotEntries := createLbEntriesFixture()
+	snapshotEntries[0].ServiceAddress = "10.254.0.1"
+	_, err = saveSnapshot(file, snapshotEntries)
+	asserter.NoError(err)
+
+	updater := new(fakeUpdater)
+	client := new(fake.FakeClient)
+	config := defaultConfig()
+	config.KubernetesClient = client
+	config.Updaters = []Updater{updater}
+	config.SnapshotFile = file
+	controller := New(config)
+
+	ingressWatcher, updateCh := createFakeWatcher()
+	serviceWatcher, _ := createFakeWatcher()
+	namespaceWatcher, _ := createFakeWatcher()
+	ingressClassWatcher, _ := createFakeWatcher()
+
+	ingresses := createDefaultIngresses()
+	liveEntries := addIngresses(ingresses, createLbEntriesFixture())
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Health").Return(nil)
+	updater.On("Update", snapshotEntries).Return(nil).Once()
+	updater.On("Update", liveEntries).Return(nil).Once()
+
+	client.On("GetAllIngresses").Return([]*networkingv1.Ingress(nil), errors.New("namespaces haven't synced yet")).Once()
+	client.On("GetAllIngresses").Return(ingresses, nil)
+	client.On("GetServices").Return(createDefaultServices(), nil)
+	client.On("GetIngressClasses").Return([]*networkingv1.IngressClass{}, nil)
+	client.On("WatchIngresses").Return(ingressWatcher)
+	client.On("WatchServices").Return(serviceWatcher)
+	client.On("WatchNamespaces").Return(namespaceWatcher)
+	client.On("WatchIngressClasses").Return(ingressClassWatcher)
+
+	// when
+	asserter.NoError(controller.Start())
+	time.Sleep(smallWaitTime)
+
+	// then
+	updater.AssertCalled(t, "Update", snapshotEntries)
+	asserter.EqualError(controller.Health(), usingSnapshot)
+	report := controller.HealthReport()
+	asserter.True(report.Degraded)
+	asserter.False(report.Ready)
+	asserter.True(report.Alive)
+
+	// and stays degraded while ingresses aren't synced
+	updateCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+	asserter.True(controller.HealthReport().Degraded)
+
+	// and uses the live ingresses once synced
+	updateCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+	asserter.NoError(controller.Health())
+	asserter.False(controller.HealthReport().Degraded)
+	updater.AssertCalled(t, "Update", liveEntries)
+	saved, err := loadSnapshot(file)
+	asserter.NoError(err)
+	if asserter.Len(saved, 1) {
+		asserter.Equal(serviceIP, saved[0].ServiceAddress, "should save the live entries")
+	}
+
+	// cleanup
+	_ = controller.Stop()
+}
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// tlsSecretsByKey returns the kubernetes.io/tls secrets by their namespace/name key.
+func tlsSecretsByKey(secrets []*v1.Secret) map[string]*v1.Secret {
+	m := make(map[string]*v1.Secret)
+	for _, secret := range secrets {
+		if secret.Type != v1.SecretTypeTLS {
+			continue
+		}
+		key, err := cache.MetaNamespaceKeyFunc(secret)
+		if err != nil {
+			continue
+		}
+		m[key] = secret
+	}
+	return m
+}
+
+// tlsSecretName returns the name of the Secret the ingress lists the host under in spec.tls. A spec.tls entry
+// without hosts applies to every host of the ingress.
+func tlsSecretName(ingress *networkingv1.Ingress, host string) (string, bool) {
+	for _, tls := range ingress.Spec.TLS {
+		if tls.SecretName == "" {
+			continue
+		}
+		if len(tls.Hosts) == 0 {
+			return tls.SecretName, true
+		}
+		for _, tlsHost := range tls.Hosts {
+			if tlsHostMatches(tlsHost, host) {
+				return tls.SecretName, true
+			}
+		}
+	}
+	return "", false
+}
+
+// tlsHostMatches returns true if the host is the tls host, or is matched by it as a wildcard such as *.example.com.
+// Wildcards only match a single label, like they do in certificates.
+func tlsHostMatches(tlsHost, host string) bool {
+	if tlsHost == host {
+		return true
+	}
+	if !strings.HasPrefix(tlsHost, "*.") {
+		return false
+	}
+	i := strings.Index(host, ".")
+	return i > 0 && host[i:] == tlsHost[1:]
+}
+
+// tlsSecretKeys returns the namespace/name keys of the Secrets referenced by the spec.tls of the ingresses.
+func tlsSecretKeys(ingresses []*networkingv1.Ingress) map[string]bool {
+	keys := make(map[string]bool)
+	for _, ingress := range ingresses {
+		for _, tls := range ingress.Spec.TLS {
+			if tls.SecretName != "" {
+				keys[ingress.Namespace+"/"+tls.SecretName] = true
+			}
+		}
+	}
+	return keys
+}
+
+// tlsCertificate returns the certificate of the Secret the ingress lists the host under, or nil if there is no such
+// Secret. An event is recorded if the Secret doesn't exist or is invalid, and the default certificate is used.
+func (c *controller) tlsCertificate(ingress *networkingv1.Ingress, host string, secrets map[string]*v1.Secret) *TLSCertificate {
+	name, ok := tlsSecretName(ingress, host)
+	if !ok {
+		return nil
+	}
+
+	secret, ok := secrets[ingress.Namespace+"/"+name]
+	if !ok {
+		c.events.record(ingress, v1.EventTypeWarning, tlsSecretNotFoundReason,
+			fmt.Sprintf("TLS secret %s for %s doesn't exist, using the default certificate", name, host))
+		return nil
+	}
+	certificate, key := secret.Data[v1.TLSCertKey], secret.Data[v1.TLSPrivateKeyKey]
+	if len(certificate) == 0 || len(key) == 0 {
+		c.events.record(ingress, v1.EventTypeWarning, invalidTLSSecretReason,
+			fmt.Sprintf("TLS secret %s for %s is missing %s or %s, using the default certificate",
+				name, host, v1.TLSCertKey, v1.TLSPrivateKeyKey))
+		return nil
+	}
+
+	return &TLSCertificate{
+		SecretNamespace: secret.Namespace,
+		SecretName:      secret.Name,
+		Certificate:     certificate,
+		Key:             key,
+	}
+}
+
+// validateTLSProfile resets the TLS profile of the entry to the default if it isn't one of the configured profiles.
+func (c *controller) validateTLSProfile(entry *IngressEntry) *AnnotationError {
+	if entry.TLSProfile == "" || c.tlsProfiles == nil {
+		return nil
+	}
+	for _, profile := range c.tlsProfiles {
+		if entry.TLSProfile == profile {
+			return nil
+		}
+	}
+	err := &AnnotationError{
+		Annotation: tlsProfileAnnotation,
+		Value:      entry.TLSProfile,
+		Reason:     fmt.Sprintf("must be one of %s", strings.Join(c.tlsProfiles, ", ")),
+		fallback:   usingDefault,
+	}
+	entry.TLSProfile = ""
+	return err
+}
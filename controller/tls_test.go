@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/sky-uk/feed/k8s"
+	fake "github.com/sky-uk/feed/util/test"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func createTLSSecretFixture(namespace, name string) *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Type:       v1.SecretTypeTLS,
+		Data: map[string][]byte{
+			v1.TLSCertKey:       []byte("certificate"),
+			v1.TLSPrivateKeyKey: []byte("key"),
+		},
+	}
+}
+
+func withTLS(ingresses []*networkingv1.Ingress, tls ...networkingv1.IngressTLS) []*networkingv1.Ingress {
+	for _, ingress := range ingresses {
+		ingress.Spec.TLS = tls
+	}
+	return ingresses
+}
+
+func tlsEntries(t *testing.T, ingresses []*networkingv1.Ingress, secrets []*v1.Secret,
+	recorder record.EventRecorder) IngressEntries {
+	client := new(fake.FakeClient)
+	client.On("GetAllIngresses").Return(ingresses, nil)
+	client.On("GetServices").Return(createDefaultServices(), nil)
+	client.On("GetIngressClasses").Return([]*networkingv1.IngressClass{}, nil)
+	client.On("GetSecrets").Return(secrets, nil)
+
+	config := defaultConfig()
+	config.KubernetesClient = client
+	config.WatchSecrets = true
+	config.EventRecorder = recorder
+	entries, err := New(config).(*controller).ingressEntries()
+	assert.NoError(t, err)
+	return entries
+}
+
+func TestTLSCertificateIsReadFromSecretListingHost(t *testing.T) {
+	ingresses := withTLS(createDefaultIngresses(),
+		networkingv1.IngressTLS{Hosts: []string{"other.sky.com"}, SecretName: "other-cert"},
+		networkingv1.IngressTLS{Hosts: []string{ingressHost}, SecretName: "cert"})
+	secrets := []*v1.Secret{
+		createTLSSecretFixture(ingressNamespace, "other-cert"),
+		createTLSSecretFixture(ingressNamespace, "cert"),
+		createTLSSecretFixture("other-namespace", "cert"),
+	}
+
+	entries := tlsEntries(t, ingresses, secrets, nil)
+
+	assert.Len(t, entries, 1)
+	assert.Equal(t, &TLSCertificate{
+		SecretNamespace: ingressNamespace,
+		SecretName:      "cert",
+		Certificate:     []byte("certificate"),
+		Key:             []byte("key"),
+	}, entries[0].TLSCertificate)
+}
+
+func TestTLSCertificateIsReadFromSecretWithoutHosts(t *testing.T) {
+	ingresses := withTLS(createDefaultIngresses(), networkingv1.IngressTLS{SecretName: "cert"})
+
+	entries := tlsEntries(t, ingresses, []*v1.Secret{createTLSSecretFixture(ingressNamespace, "cert")}, nil)
+
+	assert.Len(t, entries, 1)
+	assert.NotNil(t, entries[0].TLSCertificate)
+}
+
+func TestDefaultCertificateIsUsedForHostWithoutValidSecret(t *testing.T) {
+	invalidSecret := createTLSSecretFixture(ingressNamespace, "invalid")
+	delete(invalidSecret.Data, v1.TLSPrivateKeyKey)
+
+	var tests = []struct {
+		description string
+		tls         []networkingv1.IngressTLS
+		event       string
+	}{
+		{"no spec.tls", nil, ""},
+		{"host isn't listed", []networkingv1.IngressTLS{{Hosts: []string{"other.sky.com"}, SecretName: "cert"}}, ""},
+		{"secret doesn't exist", []networkingv1.IngressTLS{{Hosts: []string{ingressHost}, SecretName: "missing"}},
+			"Warning TLSSecretNotFound TLS secret missing for foo.sky.com doesn't exist, using the default certificate"},
+		{"secret without key", []networkingv1.IngressTLS{{Hosts: []string{ingressHost}, SecretName: "invalid"}},
+			"Warning InvalidTLSSecret TLS secret invalid for foo.sky.com is missing tls.crt or tls.key, using the default certificate"},
+	}
+
+	for _, test := range tests {
+		recorder := record.NewFakeRecorder(10)
+		ingresses := withTLS(createDefaultIngresses(), test.tls...)
+
+		entries := tlsEntries(t, ingresses, []*v1.Secret{createTLSSecretFixture(ingressNamespace, "cert"), invalidSecret},
+			recorder)
+
+		assert.Len(t, entries, 1, test.description)
+		assert.Nil(t, entries[0].TLSCertificate, test.description)
+		if test.event == "" {
+			assert.Empty(t, recorder.Events, test.description)
+		} else {
+			assert.Equal(t, test.event, <-recorder.Events, test.description)
+		}
+	}
+}
+
+func TestTLSHostMatches(t *testing.T) {
+	var tests = []struct {
+		tlsHost string
+		host    string
+		matches bool
+	}{
+		{"foo.sky.com", "foo.sky.com", true},
+		{"foo.sky.com", "bar.sky.com", false},
+		{"*.sky.com", "foo.sky.com", true},
+		{"*.sky.com", "sky.com", false},
+		{"*.sky.com", "foo.bar.sky.com", false},
+		{"*.sky.com", ".sky.com", false},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.matches, tlsHostMatches(test.tlsHost, test.host), "%s matches %s", test.tlsHost, test.host)
+	}
+}
+
+func TestOnlyChangesToReferencedSecretsAreRelevant(t *testing.T) {
+	ingresses := withTLS(createDefaultIngresses(), networkingv1.IngressTLS{SecretName: "cert"})
+	c := &controller{referencedSecrets: tlsSecretKeys(ingresses)}
+
+	assert.True(t, c.relevant(k8s.Changes{{Kind: k8s.SecretKind, Key: ingressNamespace + "/cert"}}))
+	assert.False(t, c.relevant(k8s.Changes{{Kind: k8s.SecretKind, Key: ingressNamespace + "/other"}}))
+	assert.False(t, c.relevant(k8s.Changes{{Kind: k8s.SecretKind, Key: "other/cert"}}))
+}
+
+func TestTLSProfileMustBeOneOfTheConfiguredProfiles(t *testing.T) {
+	var tests = []struct {
+		description string
+		profiles    []string
+		annotation  string
+		expected    string
+		event       string
+	}{
+		{"any profile if none are configured", nil, "modern", "modern", ""},
+		{"configured profile", []string{"default", "modern"}, "modern", "modern", ""},
+		{"unknown profile uses the default", []string{"default", "modern"}, "legacy", "",
+			"Warning InvalidAnnotation invalid sky.uk/tls-profile annotation [legacy]: must be one of default, modern, " +
+				"using the default"},
+	}
+
+	for _, test := range tests {
+		recorder := record.NewFakeRecorder(10)
+		ingresses := createDefaultIngresses()
+		ingresses[0].Annotations[tlsProfileAnnotation] = test.annotation
+		client := new(fake.FakeClient)
+		client.On("GetAllIngresses").Return(ingresses, nil)
+		client.On("GetServices").Return(createDefaultServices(), nil)
+		client.On("GetIngressClasses").Return([]*networkingv1.IngressClass{}, nil)
+
+		config := defaultConfig()
+		config.KubernetesClient = client
+		config.TLSProfiles = test.profiles
+		config.EventRecorder = recorder
+		entries, err := New(config).(*controller).ingressEntries()
+
+		assert.NoError(t, err, test.description)
+		assert.Len(t, entries, 1, test.description)
+		assert.Equal(t, test.expected, entries[0].TLSProfile, test.description)
+		if test.event == "" {
+			assert.Empty(t, recorder.Events, test.description)
+		} else {
+			assert.Equal(t, test.event, <-recorder.Events, test.description)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package controller
+
+import "time"
+
+// Defaults of Config.UpdateMaxDelay and Config.UpdateBurst.
+const (
+	DefaultUpdateMaxDelay = 10 * time.Second
+	DefaultUpdateBurst    = 1
+)
+
+// updateLimiter bounds how often ingress entries are recomputed for watcher updates. Up to burst updates run
+// as soon as they arrive, with one more allowed for every minInterval. Beyond that, updates are coalesced into
+// a pending update, which runs once no update has arrived for minInterval, or maxDelay after the first.
+type updateLimiter struct {
+	minInterval time.Duration
+	maxDelay    time.Duration
+	burst       int
+	tokens      float64
+	refilledAt  time.Time
+	// firstUpdate and lastUpdate of the pending update, which are zero if none is pending
+	firstUpdate time.Time
+	lastUpdate  time.Time
+}
+
+// newUpdateLimiter creates a limiter, which is disabled if minInterval isn't positive.
+func newUpdateLimiter(minInterval, maxDelay time.Duration, burst int) *updateLimiter {
+	if maxDelay <= 0 {
+		maxDelay = DefaultUpdateMaxDelay
+	}
+	if maxDelay < minInterval {
+		maxDelay = minInterval
+	}
+	if burst < 1 {
+		burst = DefaultUpdateBurst
+	}
+	return &updateLimiter{minInterval: minInterval, maxDelay: maxDelay, burst: burst, tokens: float64(burst)}
+}
+
+// received records a watcher update, returning true if it should be applied now. Otherwise it's added to the
+// pending update.
+func (l *updateLimiter) received(now time.Time) bool {
+	if l.minInterval <= 0 {
+		return true
+	}
+	if l.pending() {
+		l.lastUpdate = now
+		return false
+	}
+	l.refill(now)
+	if l.tokens >= 1 {
+		l.tokens--
+		return true
+	}
+	l.firstUpdate, l.lastUpdate = now, now
+	return false
+}
+
+func (l *updateLimiter) pending() bool {
+	return !l.firstUpdate.IsZero()
+}
+
+// due returns how long until the pending update should be applied, or false if none is pending.
+func (l *updateLimiter) due(now time.Time) (time.Duration, bool) {
+	if !l.pending() {
+		return 0, false
+	}
+	at := l.lastUpdate.Add(l.minInterval)
+	if deadline := l.firstUpdate.Add(l.maxDelay); deadline.Before(at) {
+		at = deadline
+	}
+	if at.Before(now) {
+		return 0, true
+	}
+	return at.Sub(now), true
+}
+
+// applied records that the pending update was applied. It uses up a token, so the next update is only applied
+// immediately once minInterval has passed.
+func (l *updateLimiter) applied(now time.Time) {
+	l.firstUpdate, l.lastUpdate = time.Time{}, time.Time{}
+	l.refill(now)
+	if l.tokens >= 1 {
+		l.tokens--
+	} else {
+		l.tokens = 0
+	}
+}
+
+func (l *updateLimiter) refill(now time.Time) {
+	if !l.refilledAt.IsZero() {
+		l.tokens += float64(now.Sub(l.refilledAt)) / float64(l.minInterval)
+		if l.tokens > float64(l.burst) {
+			l.tokens = float64(l.burst)
+		}
+	}
+	l.refilledAt = now
+}
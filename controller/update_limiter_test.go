@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	fake "github.com/sky-uk/feed/util/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+func TestUpdateLimiterIsDisabledWithoutMinInterval(t *testing.T) {
+	l := newUpdateLimiter(0, 0, 0)
+	now := time.Now()
+
+	for i := 0; i < 10; i++ {
+		assert.True(t, l.received(now))
+	}
+	_, pending := l.due(now)
+	assert.False(t, pending)
+}
+
+func TestUpdateLimiterAppliesBurstImmediatelyThenCoalesces(t *testing.T) {
+	asserter := assert.New(t)
+	l := newUpdateLimiter(time.Second, 5*time.Second, 2)
+	now := time.Now()
+
+	asserter.True(l.received(now))
+	asserter.True(l.received(now.Add(100 * time.Millisecond)))
+	asserter.False(l.received(now.Add(200*time.Millisecond)), "burst is used up")
+	asserter.False(l.received(now.Add(700 * time.Millisecond)))
+
+	delay, pending := l.due(now.Add(700 * time.Millisecond))
+	asserter.True(pending)
+	asserter.Equal(time.Second, delay, "due once no update has arrived for the min interval")
+
+	l.applied(now.Add(1700 * time.Millisecond))
+	_, pending = l.due(now.Add(1700 * time.Millisecond))
+	asserter.False(pending)
+}
+
+func TestUpdateLimiterAppliesPendingUpdateByMaxDelay(t *testing.T) {
+	asserter := assert.New(t)
+	l := newUpdateLimiter(time.Second, 3*time.Second, 1)
+	now := time.Now()
+
+	asserter.True(l.received(now))
+	for i := 1; i <= 5; i++ {
+		asserter.False(l.received(now.Add(time.Duration(i) * 500 * time.Millisecond)))
+	}
+
+	delay, pending := l.due(now.Add(2500 * time.Millisecond))
+	asserter.True(pending)
+	asserter.Equal(time.Second, delay, "due 3s after the first delayed update at 0.5s")
+}
+
+func TestUpdateLimiterRestoresBurstOverTime(t *testing.T) {
+	asserter := assert.New(t)
+	l := newUpdateLimiter(time.Second, 0, 2)
+	now := time.Now()
+
+	asserter.True(l.received(now))
+	asserter.True(l.received(now))
+	asserter.False(l.received(now))
+	l.applied(now.Add(time.Second))
+
+	asserter.False(l.received(now.Add(1500*time.Millisecond)), "applying the pending update used a token")
+	l.applied(now.Add(2500 * time.Millisecond))
+	asserter.True(l.received(now.Add(4 * time.Second)))
+	asserter.True(l.received(now.Add(5 * time.Second)))
+}
+
+func TestUpdateLimiterMaxDelayIsAtLeastMinInterval(t *testing.T) {
+	l := newUpdateLimiter(time.Minute, time.Second, 1)
+
+	assert.Equal(t, time.Minute, l.maxDelay)
+	assert.Equal(t, DefaultUpdateMaxDelay, newUpdateLimiter(time.Second, 0, 1).maxDelay)
+}
+
+func TestControllerCoalescesWatcherUpdates(t *testing.T) {
+	// given
+	asserter := assert.New(t)
+	updater := new(fakeUpdater)
+	client := new(fake.FakeClient)
+	config := defaultConfig()
+	config.KubernetesClient = client
+	config.Updaters = []Updater{updater}
+	config.UpdateMinInterval = smallWaitTime
+	controller := New(config)
+
+	ingressWatcher, updateCh := createFakeWatcher()
+	serviceWatcher, _ := createFakeWatcher()
+	namespaceWatcher, _ := createFakeWatcher()
+	ingressClassWatcher, _ := createFakeWatcher()
+
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Health").Return(nil)
+	updater.On("Update", mock.Anything).Return(nil)
+	client.On("GetAllIngresses").Return(createDefaultIngresses(), nil)
+	client.On("GetServices").Return(createDefaultServices(), nil)
+	client.On("GetIngressClasses").Return([]*networkingv1.IngressClass{}, nil)
+	client.On("WatchIngresses").Return(ingressWatcher)
+	client.On("WatchServices").Return(serviceWatcher)
+	client.On("WatchNamespaces").Return(namespaceWatcher)
+	client.On("WatchIngressClasses").Return(ingressClassWatcher)
+	coalescedBefore := metricValue(t, coalescedWatchEventsCount)
+	asserter.NoError(controller.Start())
+
+	// when
+	for i := 0; i < 5; i++ {
+		updateCh <- struct{}{}
+	}
+	time.Sleep(smallWaitTime / 2)
+
+	// then
+	updater.AssertNumberOfCalls(t, "Update", 1)
+	asserter.Equal(3.0, metricValue(t, coalescedWatchEventsCount)-coalescedBefore)
+
+	// and the coalesced updates are applied once no more arrive
+	time.Sleep(smallWaitTime * 2)
+	updater.AssertNumberOfCalls(t, "Update", 2)
+
+	// cleanup
+	asserter.NoError(controller.Stop())
+}
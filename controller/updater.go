@@ -13,3 +13,15 @@ type Updater interface {
 	// may be called often. Any long running checks should be done separately.
 	Health() error
 }
+
+// DeltaUpdater is an Updater which is told how the ingress entries changed since its last successful update,
+// so it can skip work for entries which haven't changed. The controller calls UpdateDelta instead of Update,
+// and doesn't call it at all when no entries changed.
+type DeltaUpdater interface {
+	Updater
+	// UpdateDelta updates with all the current entries, and how they differ from the entries of the
+	// last successful update. The first delta has every entry added. If UpdateDelta returns an error,
+	// the next delta is computed against the same entries, so no changes are lost.
+	// Not thread safe, should only be called by a single go routine
+	UpdateDelta(entries IngressEntries, delta IngressEntriesDelta) error
+}
@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of Config.UpdateRetryInitialBackoff and Config.UpdateRetryMaxBackoff.
+const (
+	DefaultUpdateRetryInitialBackoff = time.Second
+	DefaultUpdateRetryMaxBackoff     = 5 * time.Minute
+)
+
+// updatesHealth tracks whether the latest updates were applied. Updaters are called independently of each
+// other, so each has its own error, and is retried with exponential backoff until it succeeds.
+type updatesHealth struct {
+	sync.Mutex
+	// err is from gathering the ingress entries, in which case no updater was called.
+	err            error
+	updaters       []*updaterHealth
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+type updaterHealth struct {
+	updater             Updater
+	err                 error
+	consecutiveFailures int
+	retryAt             time.Time
+	lastSuccess         time.Time
+}
+
+func newUpdatesHealth(updaters []Updater, initialBackoff, maxBackoff time.Duration) *updatesHealth {
+	if initialBackoff <= 0 {
+		initialBackoff = DefaultUpdateRetryInitialBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultUpdateRetryMaxBackoff
+	}
+	h := &updatesHealth{initialBackoff: initialBackoff, maxBackoff: maxBackoff}
+	for _, u := range updaters {
+		h.updaters = append(h.updaters, &updaterHealth{updater: u})
+	}
+	return h
+}
+
+func (h *updatesHealth) setEntriesErr(err error) {
+	h.Lock()
+	defer h.Unlock()
+	h.err = err
+}
+
+// updated records the result of updating the updater at index i, scheduling a retry if it failed.
+func (h *updatesHealth) updated(i int, err error, now time.Time) {
+	h.Lock()
+	defer h.Unlock()
+	u := h.updaters[i]
+	u.err = err
+	if err == nil {
+		u.consecutiveFailures = 0
+		u.retryAt = time.Time{}
+		u.lastSuccess = now
+		return
+	}
+	u.consecutiveFailures++
+	u.retryAt = now.Add(h.backoff(u.consecutiveFailures))
+}
+
+// postponeRetries backs off the retries which are due, for when they can't be attempted.
+func (h *updatesHealth) postponeRetries(now time.Time) {
+	h.Lock()
+	defer h.Unlock()
+	for _, u := range h.updaters {
+		if u.err != nil && !now.Before(u.retryAt) {
+			u.consecutiveFailures++
+			u.retryAt = now.Add(h.backoff(u.consecutiveFailures))
+		}
+	}
+}
+
+// backoff doubles the delay before retrying for each consecutive failure, up to maxBackoff.
+func (h *updatesHealth) backoff(failures int) time.Duration {
+	backoff := h.initialBackoff
+	for i := 1; i < failures && backoff < h.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > h.maxBackoff {
+		return h.maxBackoff
+	}
+	return backoff
+}
+
+// retryDue returns true if the updater at index i failed, and its retry is due.
+func (h *updatesHealth) retryDue(i int, now time.Time) bool {
+	h.Lock()
+	defer h.Unlock()
+	u := h.updaters[i]
+	return u.err != nil && !now.Before(u.retryAt)
+}
+
+// nextRetry returns how long until the next retry of a failed updater, or false if none failed.
+func (h *updatesHealth) nextRetry(now time.Time) (time.Duration, bool) {
+	h.Lock()
+	defer h.Unlock()
+	var next time.Time
+	for _, u := range h.updaters {
+		if u.err != nil && (next.IsZero() || u.retryAt.Before(next)) {
+			next = u.retryAt
+		}
+	}
+	if next.IsZero() {
+		return 0, false
+	}
+	if next.Before(now) {
+		return 0, true
+	}
+	return next.Sub(now), true
+}
+
+// get returns an error describing every failed update, or nil if all were applied.
+func (h *updatesHealth) get() error {
+	h.Lock()
+	defer h.Unlock()
+	if h.err != nil {
+		return h.err
+	}
+	var errs []string
+	for _, u := range h.updaters {
+		if u.err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", updaterName(u.updater), u.err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// report describes the updates of the updater at index i.
+func (h *updatesHealth) report(i int) UpdaterHealth {
+	h.Lock()
+	defer h.Unlock()
+	u := h.updaters[i]
+	report := UpdaterHealth{ConsecutiveFailures: u.consecutiveFailures}
+	if !u.lastSuccess.IsZero() {
+		lastSuccess := u.lastSuccess
+		report.LastSuccessfulUpdate = &lastSuccess
+	}
+	if u.err != nil {
+		report.LastUpdateError = u.err.Error()
+	}
+	return report
+}
+
+func (h *updatesHealth) entriesErr() error {
+	h.Lock()
+	defer h.Unlock()
+	return h.err
+}
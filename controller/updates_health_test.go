@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdatesHealthBacksOffExponentially(t *testing.T) {
+	asserter := assert.New(t)
+	health := newUpdatesHealth([]Updater{new(fakeUpdater)}, time.Second, 5*time.Second)
+	now := time.Now()
+
+	var delays []time.Duration
+	for i := 0; i < 5; i++ {
+		health.updated(0, errors.New("kaboom"), now)
+		delay, ok := health.nextRetry(now)
+		asserter.True(ok)
+		delays = append(delays, delay)
+	}
+
+	asserter.Equal([]time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}, delays)
+	asserter.False(health.retryDue(0, now))
+	asserter.True(health.retryDue(0, now.Add(5*time.Second)))
+
+	health.updated(0, nil, now)
+	_, ok := health.nextRetry(now)
+	asserter.False(ok, "should not retry after a successful update")
+	asserter.False(health.retryDue(0, now.Add(time.Hour)))
+	health.updated(0, errors.New("kaboom"), now)
+	delay, _ := health.nextRetry(now)
+	asserter.Equal(time.Second, delay, "should reset backoff after a successful update")
+}
+
+func TestUpdatesHealthReportsEveryFailedUpdater(t *testing.T) {
+	asserter := assert.New(t)
+	health := newUpdatesHealth([]Updater{new(fakeUpdater), new(fakeUpdater), new(fakeUpdater)}, 0, 0)
+	now := time.Now()
+
+	asserter.NoError(health.get())
+
+	health.updated(0, errors.New("kaboom"), now)
+	health.updated(1, nil, now)
+	health.updated(2, errors.New("dead"), now)
+	asserter.EqualError(health.get(), "FakeUpdater: kaboom; FakeUpdater: dead")
+
+	health.setEntriesErr(errors.New("found 0 ingresses"))
+	asserter.EqualError(health.get(), "found 0 ingresses")
+}
+
+func TestUpdatesHealthPostponesDueRetries(t *testing.T) {
+	asserter := assert.New(t)
+	health := newUpdatesHealth([]Updater{new(fakeUpdater), new(fakeUpdater)}, time.Second, time.Minute)
+	now := time.Now()
+	health.updated(0, errors.New("kaboom"), now)
+	health.updated(1, nil, now)
+
+	health.postponeRetries(now.Add(time.Second))
+
+	asserter.False(health.retryDue(0, now.Add(time.Second)))
+	delay, ok := health.nextRetry(now.Add(time.Second))
+	asserter.True(ok)
+	asserter.Equal(2*time.Second, delay)
+	asserter.False(health.retryDue(1, now.Add(time.Hour)), "should not retry successful updaters")
+}
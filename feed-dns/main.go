@@ -13,6 +13,7 @@ import (
 	"github.com/sky-uk/feed/k8s"
 	"github.com/sky-uk/feed/util/cmd"
 	"github.com/sky-uk/feed/util/metrics"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 var (
@@ -31,6 +32,16 @@ var (
 	internalHostname           string
 	externalHostname           string
 	cnameTimeToLive            time.Duration
+	ingressClassName           string
+	retryBackoff               time.Duration
+	retryMaxBackoff            time.Duration
+	maxRemovedEntries          int
+	maxRemovedEntriesPercent   int
+	ingressSelector            string
+	watchNamespaces            cmd.CommaSeparatedValues
+	updateMinInterval          time.Duration
+	updateMaxDelay             time.Duration
+	updateBurst                int
 )
 
 func init() {
@@ -51,6 +62,23 @@ func init() {
 		"Path to kubeconfig for connecting to the API server. Leave blank to connect inside a cluster.")
 	flag.DurationVar(&resyncPeriod, "resync-period", defaultResyncPeriod,
 		"Resync with the API server periodically to handle missed updates.")
+	flag.DurationVar(&retryBackoff, "update-retry-initial-backoff", controller.DefaultUpdateRetryInitialBackoff,
+		"How long to wait before retrying a failed update. Doubles with each consecutive failure.")
+	flag.DurationVar(&retryMaxBackoff, "update-retry-max-backoff", controller.DefaultUpdateRetryMaxBackoff,
+		"Maximum time to wait before retrying a failed update.")
+	flag.DurationVar(&updateMinInterval, "update-min-interval", 0,
+		"Coalesce Kubernetes changes, so ingresses are recomputed at most once per interval after the burst is used up. "+
+			"Delayed changes are applied once none has arrived for the interval. 0 to apply every change immediately.")
+	flag.DurationVar(&updateMaxDelay, "update-max-delay", controller.DefaultUpdateMaxDelay,
+		"Maximum time a change is delayed by -update-min-interval while further changes keep arriving.")
+	flag.IntVar(&updateBurst, "update-burst", controller.DefaultUpdateBurst,
+		"Number of changes applied immediately before -update-min-interval delays them.")
+	flag.IntVar(&maxRemovedEntries, "max-removed-entries", controller.DefaultMaxRemovedEntries,
+		"Refuse updates which remove more than this many ingress entries, until overridden with a POST to "+
+			"/override-removal-threshold on the health port. 0 to disable.")
+	flag.IntVar(&maxRemovedEntriesPercent, "max-removed-entries-percent", controller.DefaultMaxRemovedEntriesPercent,
+		"Refuse updates which remove more than this percentage of the ingress entries, until overridden with a "+
+			"POST to /override-removal-threshold on the health port. 0 to disable.")
 	flag.IntVar(&healthPort, "health-port", defaultHealthPort,
 		"Port for checking the health of the ingress controller.")
 	flag.Var(&albNames, "alb-names",
@@ -76,6 +104,16 @@ func init() {
 		"Hostname of the internet facing load-balancer. If specified, internal-hostname must also be given.")
 	flag.DurationVar(&cnameTimeToLive, "cname-ttl", defaultCnameTTL,
 		"Time-to-live of CNAME records")
+	flag.StringVar(&ingressClassName, "ingress-class", "",
+		"The name of the feed instance whose ingresses are managed. Considers ingresses with a matching "+
+			"kubernetes.io/ingress.class annotation, or an ingressClassName whose IngressClass has the controller "+
+			controller.IngressClassControllerPrefix+"<name>.")
+	flag.StringVar(&ingressSelector, "ingress-selector", "",
+		"Only manage ingresses having labels matching this label selector (e.g. shard=a), "+
+			"to shard ingresses between feed instances.")
+	flag.Var(&watchNamespaces, "watch-namespaces",
+		"Comma separated list of namespaces to watch ingresses and services in, instead of the whole cluster. "+
+			"Only needs access to these resources in those namespaces, and none to namespaces.")
 }
 
 func main() {
@@ -85,7 +123,12 @@ func main() {
 	cmd.ConfigureLogging(debug)
 	cmd.ConfigureMetrics("feed-dns", pushgatewayLabels, pushgatewayURL, pushgatewayIntervalSeconds)
 
-	client, err := k8s.New(kubeconfig, resyncPeriod)
+	selector, err := labels.Parse(ingressSelector)
+	if err != nil {
+		log.Fatalf("Invalid format for -ingress-selector (%s): %v", ingressSelector, err)
+	}
+
+	client, err := k8s.NewNamespaced(kubeconfig, resyncPeriod, watchNamespaces)
 	if err != nil {
 		log.Fatal("Unable to create k8s client: ", err)
 	}
@@ -97,8 +140,18 @@ func main() {
 	dnsUpdater := dns.New(r53HostedZone, lbAdapter, awsAPIRetries)
 
 	feedController := controller.New(controller.Config{
-		KubernetesClient: client,
-		Updaters:         []controller.Updater{dnsUpdater},
+		KubernetesClient:          client,
+		Updaters:                  []controller.Updater{dnsUpdater},
+		Name:                      ingressClassName,
+		UpdateRetryInitialBackoff: retryBackoff,
+		UpdateRetryMaxBackoff:     retryMaxBackoff,
+		MaxRemovedEntries:         maxRemovedEntries,
+		MaxRemovedEntriesPercent:  maxRemovedEntriesPercent,
+		UpdateMinInterval:         updateMinInterval,
+		UpdateMaxDelay:            updateMaxDelay,
+		UpdateBurst:               updateBurst,
+		MetricsSubsystem:          metrics.PrometheusDNSSubsystem,
+		IngressSelector:           selector,
 	})
 
 	cmd.AddHealthMetrics(feedController, metrics.PrometheusDNSSubsystem)
@@ -1,14 +1,19 @@
 package cmd
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
 	"strings"
 
+	"github.com/sky-uk/feed/k8s/status"
 	"github.com/sky-uk/feed/nginx"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/sky-uk/feed/controller"
 	"github.com/sky-uk/feed/k8s"
 	"github.com/sky-uk/feed/util/metrics"
+	"k8s.io/apimachinery/pkg/labels"
 
 	cmdutil "github.com/sky-uk/feed/util/cmd"
 )
@@ -25,20 +30,36 @@ func runCmd(appender appendIngressUpdaters) {
 	cmdutil.ConfigureLogging(debug)
 	cmdutil.ConfigureMetrics("feed-ingress", pushgatewayLabels, pushgatewayURL, pushgatewayIntervalSeconds)
 
-	client, err := k8s.New(kubeconfig, resyncPeriod)
+	if len(watchNamespaces) > 0 && namespaceSelector != "" {
+		log.Fatalf("--%s can't be used with --%s", watchNamespacesFlag, ingressControllerNamespaceSelectorFlag)
+	}
+
+	client, err := k8s.NewNamespaced(kubeconfig, resyncPeriod, watchNamespaces)
 	if err != nil {
 		log.Fatal("Unable to create k8s client: ", err)
 	}
 	controllerConfig.KubernetesClient = client
+	controllerConfig.EventRecorder = client.EventRecorder("feed-ingress")
+
+	nginxConfig.TLSProfiles, err = parseTLSProfiles(nginxTLSProfiles)
+	if err != nil {
+		log.Fatalf("invalid --%s: %v", tlsProfileFlag, err)
+	}
+	controllerConfig.TLSProfiles = nginx.TLSProfileNames(nginxConfig.TLSProfiles)
 
 	controllerConfig.Updaters, err = createIngressUpdaters(client, appender)
 	if err != nil {
 		log.Fatal("Unable to create ingress updaters: ", err)
 	}
 
-	controllerConfig.NamespaceSelector, err = parseNamespaceSelector(namespaceSelector)
+	controllerConfig.NamespaceSelector, err = k8s.ParseNamespaceSelector(namespaceSelector)
 	if err != nil {
-		log.Fatalf("invalid format for --%s (%s)", ingressControllerNamespaceSelectorFlag, namespaceSelector)
+		log.Fatalf("invalid format for --%s (%s): %v", ingressControllerNamespaceSelectorFlag, namespaceSelector, err)
+	}
+
+	controllerConfig.IngressSelector, err = labels.Parse(ingressSelector)
+	if err != nil {
+		log.Fatalf("invalid format for --%s (%s): %v", ingressSelectorFlag, ingressSelector, err)
 	}
 
 	feedController := controller.New(controllerConfig)
@@ -65,6 +86,7 @@ func createIngressUpdaters(kubernetesClient k8s.Client, appender appendIngressUp
 	nginxConfig.VhostStatsSharedMemory = nginxVhostStatsSharedMemory
 	nginxConfig.OpenTracingPlugin = nginxOpenTracingPluginPath
 	nginxConfig.OpenTracingConfig = nginxOpenTracingConfigPath
+	nginxConfig.EventRecorder = kubernetesClient.EventRecorder("feed-ingress")
 	nginxUpdater := nginx.New(nginxConfig)
 
 	updaters := []controller.Updater{nginxUpdater}
@@ -75,6 +97,52 @@ func createIngressUpdaters(kubernetesClient k8s.Client, appender appendIngressUp
 	return updaters, nil
 }
 
+// parseTLSProfiles parses the --tls-profile flags by name.
+func parseTLSProfiles(values []string) (map[string]nginx.TLSProfile, error) {
+	profiles := make(map[string]nginx.TLSProfile)
+	for _, value := range values {
+		name, profile, err := nginx.ParseTLSProfile(value)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := profiles[name]; ok {
+			return nil, fmt.Errorf("TLS profile %s is defined more than once", name)
+		}
+		profiles[name] = profile
+	}
+	return profiles, nil
+}
+
+// serviceAccountNamespaceFile holds the namespace of the pod, when running inside a cluster.
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// leaderElectedStatusUpdater wraps a status updater to only update statuses while leader, if enabled by flags.
+// The lease is named after the ingress class, so each class elects its own leader.
+func leaderElectedStatusUpdater(kubernetesClient k8s.Client, updater controller.Updater) (controller.Updater, error) {
+	if !statusLeaderElection {
+		return updater, nil
+	}
+
+	config := statusLeaderElectionConfig
+	config.Name = "feed-ingress-status-" + ingressClassName
+	config.KubernetesClient = kubernetesClient
+	if config.Namespace == "" {
+		namespace, err := ioutil.ReadFile(serviceAccountNamespaceFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to determine the namespace for leader election, "+
+				"set --status-leader-election-namespace: %v", err)
+		}
+		config.Namespace = strings.TrimSpace(string(namespace))
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine the identity for leader election: %v", err)
+	}
+	config.Identity = identity
+
+	return status.NewLeaderElected(updater, config)
+}
+
 func createPortsConfig(ingressPort int, ingressHTTPSPort int) []nginx.Port {
 	var ports = []nginx.Port{}
 	if ingressPort != unset {
@@ -89,15 +157,3 @@ func createPortsConfig(ingressPort int, ingressHTTPSPort int) []nginx.Port {
 	}
 	return ports
 }
-
-func parseNamespaceSelector(nameValueStr string) (*k8s.NamespaceSelector, error) {
-	if len(nameValueStr) == 0 {
-		return nil, nil
-	}
-
-	nameValue := strings.SplitN(nameValueStr, "=", 2)
-	if len(nameValue) != 2 {
-		log.Errorf("expecting name=value but was (%s)", nameValueStr)
-	}
-	return &k8s.NamespaceSelector{LabelName: nameValue[0], LabelValue: nameValue[1]}, nil
-}
@@ -66,5 +66,9 @@ func appendElbIngressUpdaters(kubernetesClient k8s.Client, updaters []controller
 	if err != nil {
 		return nil, err
 	}
+	elbStatusUpdater, err = leaderElectedStatusUpdater(kubernetesClient, elbStatusUpdater)
+	if err != nil {
+		return nil, err
+	}
 	return append(updaters, elbStatusUpdater), nil
 }
@@ -118,6 +118,10 @@ func appendMerlinIngressUpdaters(kubernetesClient k8s.Client, updaters []control
 		if err != nil {
 			return nil, err
 		}
+		merlinStatusUpdater, err = leaderElectedStatusUpdater(kubernetesClient, merlinStatusUpdater)
+		if err != nil {
+			return nil, err
+		}
 		updaters = append(updaters, merlinStatusUpdater)
 	}
 
@@ -48,5 +48,9 @@ func appendNlbIngressUpdaters(kubernetesClient k8s.Client, updaters []controller
 	if err != nil {
 		return nil, err
 	}
+	statusUpdater, err = leaderElectedStatusUpdater(kubernetesClient, statusUpdater)
+	if err != nil {
+		return nil, err
+	}
 	return append(updaters, statusUpdater), nil
 }
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/k8s/status"
 	"github.com/sky-uk/feed/nginx"
 	"github.com/sky-uk/feed/util/cmd"
 	"github.com/spf13/cobra"
@@ -41,6 +42,7 @@ var (
 	nginxLogHeaders             []string
 	nginxTrustedFrontends       []string
 	nginxSSLPath                string
+	nginxTLSProfiles            []string
 	nginxVhostStatsSharedMemory int
 	nginxOpenTracingPluginPath  string
 	nginxOpenTracingConfigPath  string
@@ -48,6 +50,11 @@ var (
 	ingressClassName        string
 	includeUnnamedIngresses bool
 	namespaceSelector       string
+	ingressSelector         string
+	watchNamespaces         []string
+
+	statusLeaderElection       bool
+	statusLeaderElectionConfig status.LeaderElectionConfig
 
 	pushgatewayURL             string
 	pushgatewayIntervalSeconds int
@@ -64,6 +71,9 @@ const (
 	defaultIngressAllow      = "0.0.0.0/0"
 	defaultIngressStripPath  = true
 	defaultIngressExactPath  = false
+	defaultRouteToEndpoints  = false
+	defaultWatchEndpoints    = false
+	defaultStrictAnnotations = false
 	defaultHealthPort        = 12082
 
 	defaultNginxBinary                       = "/usr/sbin/nginx"
@@ -85,6 +95,7 @@ const (
 	defaultNginxUpdatePeriod                 = time.Second * 30
 	defaultNginxSSLPath                      = "/etc/ssl/default-ssl/default-ssl"
 	defaultNginxVhostStatsSharedMemory       = 1
+	defaultNginxRateLimitSharedMemory        = 1
 	defaultNginxOpenTracingPluginPath        = ""
 	defaultNginxOpenTracingConfigPath        = ""
 	defaultAccessLogDir                      = "/var/log/nginx"
@@ -96,6 +107,10 @@ const (
 	defaultIncludeUnnamedIngresses            = false
 	defaultIngressControllerNamespaceSelector = ""
 
+	defaultStatusLeaseDuration = time.Second * 15
+	defaultStatusRenewDeadline = time.Second * 10
+	defaultStatusRetryPeriod   = time.Second * 2
+
 	defaultPushgatewayIntervalSeconds = 60
 )
 
@@ -103,6 +118,10 @@ const (
 	ingressClassFlag                       = "ingress-class"
 	includeClasslessIngressesFlag          = "include-classless-ingresses"
 	ingressControllerNamespaceSelectorFlag = "ingress-controller-namespace-selector"
+	ingressSelectorFlag                    = "ingress-selector"
+	watchNamespacesFlag                    = "watch-namespaces"
+	statusLeaderElectionFlag               = "status-leader-election"
+	tlsProfileFlag                         = "tls-profile"
 
 	ingressClassAnnotation = "kubernetes.io/ingress.class"
 )
@@ -120,6 +139,31 @@ func configureGeneralFlags() {
 		"Path to kubeconfig for connecting to the apiserver. Leave blank to connect inside a cluster.")
 	rootCmd.PersistentFlags().DurationVar(&resyncPeriod, "resync-period", defaultResyncPeriod,
 		"Resync with the apiserver periodically to handle missed updates.")
+	rootCmd.PersistentFlags().DurationVar(&controllerConfig.UpdateRetryInitialBackoff, "update-retry-initial-backoff",
+		controller.DefaultUpdateRetryInitialBackoff,
+		"How long to wait before retrying a failed update. Doubles with each consecutive failure.")
+	rootCmd.PersistentFlags().DurationVar(&controllerConfig.UpdateRetryMaxBackoff, "update-retry-max-backoff",
+		controller.DefaultUpdateRetryMaxBackoff, "Maximum time to wait before retrying a failed update.")
+	rootCmd.PersistentFlags().DurationVar(&controllerConfig.UpdateMinInterval, "update-min-interval", 0,
+		"Coalesce Kubernetes changes, so ingresses are recomputed at most once per interval after the burst is used up. "+
+			"Delayed changes are applied once none has arrived for the interval. 0 to apply every change immediately.")
+	rootCmd.PersistentFlags().DurationVar(&controllerConfig.UpdateMaxDelay, "update-max-delay",
+		controller.DefaultUpdateMaxDelay,
+		"Maximum time a change is delayed by --update-min-interval while further changes keep arriving.")
+	rootCmd.PersistentFlags().IntVar(&controllerConfig.UpdateBurst, "update-burst", controller.DefaultUpdateBurst,
+		"Number of changes applied immediately before --update-min-interval delays them.")
+	rootCmd.PersistentFlags().StringVar(&controllerConfig.SnapshotFile, "snapshot-file", "",
+		"File to save the last ingress entries applied by every updater to, such as /nginx/snapshot.json. "+
+			"On start, nginx is configured from the snapshot until ingresses are synced, so it can serve traffic "+
+			"while the apiserver is unavailable. Leave blank to disable.")
+	rootCmd.PersistentFlags().IntVar(&controllerConfig.MaxRemovedEntries, "max-removed-entries",
+		controller.DefaultMaxRemovedEntries,
+		"Refuse updates which remove more than this many ingress entries, until overridden with a POST to "+
+			"/override-removal-threshold on the health port. 0 to disable.")
+	rootCmd.PersistentFlags().IntVar(&controllerConfig.MaxRemovedEntriesPercent, "max-removed-entries-percent",
+		controller.DefaultMaxRemovedEntriesPercent,
+		"Refuse updates which remove more than this percentage of the ingress entries, until overridden with a "+
+			"POST to /override-removal-threshold on the health port. 0 to disable.")
 	rootCmd.PersistentFlags().IntVar(&ingressPort, "ingress-port", defaultIngressPort,
 		"Port to serve ingress traffic to backend services.")
 	rootCmd.PersistentFlags().IntVar(&ingressHTTPSPort, "ingress-https-port", defaultIngressHTTPSPort,
@@ -140,15 +184,51 @@ func configureGeneralFlags() {
 		"Whether to consider the ingress path to be an exact match rather than as a prefix. For example, "+
 			"if enabled 'myhost/myapp/health' would match 'myhost/myapp/health' but not 'myhost/myapp/health/x'."+
 			" If disabled, it would match both (and redirect requests from 'myhost/myapp/health' to "+
-			" '/myhost/myapp/health/'. Can be overridden with the sky.uk/exact-path annotation per ingress")
+			" '/myhost/myapp/health/'. Can be overridden with the sky.uk/exact-path annotation per ingress. "+
+			"Ingress paths with a pathType of Exact or Prefix ignore this setting.")
+	rootCmd.PersistentFlags().BoolVar(&controllerConfig.DefaultRouteToEndpoints, "ingress-route-to-endpoints", defaultRouteToEndpoints,
+		"Whether to proxy traffic directly to the ready pods of backend services, instead of to their cluster IPs. "+
+			"This allows headless services to be used as backends. Implies --watch-endpoints. "+
+			"Can be overridden with the sky.uk/route-to-endpoints annotation per ingress.")
+	rootCmd.PersistentFlags().BoolVar(&controllerConfig.WatchEndpoints, "watch-endpoints", defaultWatchEndpoints,
+		"Watch the endpoints of backend services, so ingresses can opt in to routing directly to pods with the "+
+			"sky.uk/route-to-endpoints annotation. Requires permission to list and watch endpoints.")
+	rootCmd.PersistentFlags().BoolVar(&controllerConfig.WatchSecrets, "watch-secrets", false,
+		"Watch kubernetes.io/tls Secrets, to serve the certificate of the Secret each ingress lists a host under in "+
+			"spec.tls on the https port. Requires permission to list and watch secrets.")
+	rootCmd.PersistentFlags().BoolVar(&controllerConfig.StrictAnnotations, "strict-annotations", defaultStrictAnnotations,
+		"Skip ingress paths with invalid sky.uk annotation values, instead of using the defaults in their place.")
 	rootCmd.PersistentFlags().IntVar(&healthPort, "health-port", defaultHealthPort,
 		"Port for checking the health of the ingress controller on /health. Also provides /debug/pprof.")
 	rootCmd.PersistentFlags().StringVar(&ingressClassName, ingressClassFlag, defaultIngressClassName,
-		fmt.Sprintf("The name of this instance. It will consider only ingress resources with matching %s annotation values.", ingressClassAnnotation))
+		fmt.Sprintf("The name of this instance. It will consider only ingress resources with matching %s annotation values, "+
+			"or with an ingressClassName whose IngressClass has the controller %s<name>.",
+			ingressClassAnnotation, controller.IngressClassControllerPrefix))
 	rootCmd.PersistentFlags().BoolVar(&includeUnnamedIngresses, includeClasslessIngressesFlag, defaultIncludeUnnamedIngresses,
-		fmt.Sprintf("In addition to ingress resources with matching %s annotations, also consider those with no such annotation.", ingressClassAnnotation))
+		fmt.Sprintf("In addition to ingress resources with matching %s annotations, also consider those with no such annotation "+
+			"or ingressClassName.", ingressClassAnnotation))
 	rootCmd.PersistentFlags().StringVar(&namespaceSelector, ingressControllerNamespaceSelectorFlag, defaultIngressControllerNamespaceSelector,
-		"Only consider ingresses within namespaces having labels matching this selector (e.g. app=loadtest).")
+		"Only consider ingresses within namespaces having labels matching this label selector "+
+			"(e.g. app=loadtest or 'team in (a,b),!deprecated').")
+	rootCmd.PersistentFlags().StringVar(&ingressSelector, ingressSelectorFlag, "",
+		"Only consider ingresses having labels matching this label selector (e.g. shard=a), "+
+			"to shard ingresses between feed instances.")
+	rootCmd.PersistentFlags().StringSliceVar(&watchNamespaces, watchNamespacesFlag, []string{},
+		"Comma separated list of namespaces to watch ingresses, services and endpoints in, instead of the whole cluster. "+
+			"Only needs access to these resources in those namespaces, and none to namespaces. "+
+			"Can't be used with --"+ingressControllerNamespaceSelectorFlag+".")
+
+	rootCmd.PersistentFlags().BoolVar(&statusLeaderElection, statusLeaderElectionFlag, false,
+		"Elect a leader between replicas of the same ingress class with a Lease, so only the leader updates ingress "+
+			"statuses. Requires permission to get, create and update leases.")
+	rootCmd.PersistentFlags().StringVar(&statusLeaderElectionConfig.Namespace, "status-leader-election-namespace", "",
+		"Namespace of the Lease used by --"+statusLeaderElectionFlag+". Defaults to the namespace feed-ingress runs in.")
+	rootCmd.PersistentFlags().DurationVar(&statusLeaderElectionConfig.LeaseDuration, "status-leader-election-lease-duration",
+		defaultStatusLeaseDuration, "How long other replicas wait before taking over from a leader which stopped renewing its lease.")
+	rootCmd.PersistentFlags().DurationVar(&statusLeaderElectionConfig.RenewDeadline, "status-leader-election-renew-deadline",
+		defaultStatusRenewDeadline, "How long the leader keeps retrying to renew its lease before giving up leadership.")
+	rootCmd.PersistentFlags().DurationVar(&statusLeaderElectionConfig.RetryPeriod, "status-leader-election-retry-period",
+		defaultStatusRetryPeriod, "How often replicas try to acquire or renew the lease.")
 
 	_ = rootCmd.PersistentFlags().MarkDeprecated(includeClasslessIngressesFlag,
 		fmt.Sprintf("please annotate ingress resources explicitly with %s", ingressClassAnnotation))
@@ -208,9 +288,19 @@ func configureNginxFlags() {
 			"frontends. The client IP is used for allowing or denying ingress access. "+
 			"This will typically be the ELB subnet.")
 	rootCmd.PersistentFlags().StringVar(&nginxSSLPath, "ssl-path", defaultNginxSSLPath,
-		"Set default ssl path + name file without extension.  Feed expects two files: one ending in .crt (the CA) and the other in .key (the private key).")
+		"Set default ssl path + name file without extension.  Feed expects two files: one ending in .crt (the CA) and the other in .key (the private key). "+
+			"Used for hosts without a certificate from --watch-secrets.")
+	rootCmd.PersistentFlags().StringArrayVar(&nginxTLSProfiles, tlsProfileFlag, []string{},
+		"Named TLS profile ingresses can choose with the sky.uk/tls-profile annotation, as "+
+			"name:setting=value;setting=value. Settings are protocols, ciphers, prefer-server-ciphers, "+
+			"session-timeout and session-tickets, and default to those of the default profile. "+
+			"Repeat for each profile. A profile named default is used by ingresses without the annotation, "+
+			"e.g. --tls-profile 'modern:protocols=TLSv1.3;ciphers='.")
 	rootCmd.PersistentFlags().IntVar(&nginxVhostStatsSharedMemory, "nginx-vhost-stats-shared-memory", defaultNginxVhostStatsSharedMemory,
 		"Memory (in MiB) which should be allocated for use by the vhost statistics module")
+	rootCmd.PersistentFlags().IntVar(&nginxConfig.RateLimitSharedMemory, "nginx-rate-limit-shared-memory", defaultNginxRateLimitSharedMemory,
+		"Memory (in MiB) allocated to the rate limit zone of each ingress with the sky.uk/rate-limit annotation. "+
+			"1 MiB holds the state of about 16,000 client IPs.")
 	rootCmd.PersistentFlags().StringVar(&nginxOpenTracingPluginPath, "nginx-opentracing-plugin-path", defaultNginxOpenTracingPluginPath,
 		"Path to OpenTracing plugin on disk (eg. /usr/local/lib/libjaegertracing_plugin.so)")
 	rootCmd.PersistentFlags().StringVar(&nginxOpenTracingConfigPath, "nginx-opentracing-config-path", defaultNginxOpenTracingConfigPath,
@@ -7,6 +7,7 @@ The types are copied from the stable api of the Kubernetes 1.3 release.
 package k8s
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"time"
@@ -15,11 +16,17 @@ import (
 
 	log "github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
 )
 
 // Time to handle multiple updates occurring in a short time period, such as at startup where
@@ -32,14 +39,23 @@ const bufferedWatcherDuration = time.Millisecond * 50
 // It's intended that client code will call the getters to retrieve the current state when notified.
 type Client interface {
 	// GetAllIngresses returns all the ingresses in the cluster.
-	GetAllIngresses() ([]*v1beta1.Ingress, error)
+	GetAllIngresses() ([]*networkingv1.Ingress, error)
 
 	// GetIngresses returns ingresses in namespaces with matching labels
-	GetIngresses(*NamespaceSelector) ([]*v1beta1.Ingress, error)
+	GetIngresses(*NamespaceSelector) ([]*networkingv1.Ingress, error)
 
 	// GetServices returns all the services in the cluster.
 	GetServices() ([]*v1.Service, error)
 
+	// GetEndpoints returns all the endpoints in the cluster.
+	GetEndpoints() ([]*v1.Endpoints, error)
+
+	// GetIngressClasses returns all the ingress classes in the cluster.
+	GetIngressClasses() ([]*networkingv1.IngressClass, error)
+
+	// GetSecrets returns all the kubernetes.io/tls secrets in the cluster.
+	GetSecrets() ([]*v1.Secret, error)
+
 	// WatchIngresses watches for updates to ingresses and notifies the Watcher.
 	WatchIngresses() Watcher
 
@@ -49,33 +65,99 @@ type Client interface {
 	// WatchNamespaces watches for updates to namespaces and notifies the Watcher.
 	WatchNamespaces() Watcher
 
+	// WatchEndpoints watches for updates to endpoints and notifies the Watcher.
+	WatchEndpoints() Watcher
+
+	// WatchIngressClasses watches for updates to ingress classes and notifies the Watcher.
+	WatchIngressClasses() Watcher
+
+	// WatchSecrets watches for updates to kubernetes.io/tls secrets and notifies the Watcher.
+	WatchSecrets() Watcher
+
 	// UpdateIngressStatus updates the ingress status with the loadbalancer hostname or ip address.
-	UpdateIngressStatus(*v1beta1.Ingress) error
+	UpdateIngressStatus(*networkingv1.Ingress) error
+
+	// EventRecorder returns a recorder for Kubernetes events reported by the given component.
+	// Similar events on the same object are aggregated and rate limited.
+	EventRecorder(component string) record.EventRecorder
+
+	// LeaseLock returns a lock on the named Lease, held by identity, for electing a leader between replicas.
+	LeaseLock(namespace, name, identity string) resourcelock.Interface
+
+	// Stop stops watching the API server and recording events. Watchers stop sending updates, and the
+	// client shouldn't be used afterwards.
+	Stop()
 }
 
 type client struct {
 	sync.Mutex
-	clientset           *kubernetes.Clientset
-	resyncPeriod        time.Duration
-	ingressStore        cache.Store
-	ingressController   cache.Controller
-	ingressWatcher      *handlerWatcher
-	serviceStore        cache.Store
-	serviceController   cache.Controller
-	serviceWatcher      *handlerWatcher
-	namespaceStore      cache.Store
-	namespaceController cache.Controller
-	namespaceWatcher    *handlerWatcher
-}
-
-// NamespaceSelector defines the label name and value for filtering namespaces
+	clientset    kubernetes.Interface
+	resyncPeriod time.Duration
+	// namespaces watched for ingresses, services and endpoints, or every namespace if empty
+	namespaces []string
+	// clusterFactory creates informers of cluster scoped resources, and of namespaced resources if watching every
+	// namespace. Otherwise namespacedFactories has a factory for each watched namespace.
+	clusterFactory      informers.SharedInformerFactory
+	namespacedFactories []informers.SharedInformerFactory
+	// stopCh stops every informer and watcher
+	stopCh           chan struct{}
+	stopped          bool
+	ingresses        *source
+	services         *source
+	namespaceSource  *source
+	endpoints        *source
+	ingressClasses   *source
+	secrets          *source
+	eventBroadcaster record.EventBroadcaster
+}
+
+// NamespaceSelector selects namespaces by their labels.
 type NamespaceSelector struct {
+	// Selector is a Kubernetes label selector, such as "team in (a,b),!deprecated". Takes precedence over
+	// LabelName and LabelValue.
+	Selector labels.Selector
+	// Deprecated: retained to maintain backwards compatibility. Use Selector.
 	LabelName  string
 	LabelValue string
 }
 
+// ParseNamespaceSelector parses a Kubernetes label selector, returning nil if it's empty.
+func ParseNamespaceSelector(selector string) (*NamespaceSelector, error) {
+	if selector == "" {
+		return nil, nil
+	}
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return nil, err
+	}
+	return &NamespaceSelector{Selector: parsed}, nil
+}
+
+// Matches returns true if the namespace labels match the selector.
+func (s *NamespaceSelector) Matches(namespaceLabels map[string]string) bool {
+	if s.Selector != nil {
+		return s.Selector.Matches(labels.Set(namespaceLabels))
+	}
+	val, ok := namespaceLabels[s.LabelName]
+	return ok && val == s.LabelValue
+}
+
+func (s *NamespaceSelector) String() string {
+	if s.Selector != nil {
+		return s.Selector.String()
+	}
+	return s.LabelName + "=" + s.LabelValue
+}
+
 // New creates a client for the kubernetes API server.
 func New(kubeconfig string, resyncPeriod time.Duration) (Client, error) {
+	return NewNamespaced(kubeconfig, resyncPeriod, nil)
+}
+
+// NewNamespaced creates a client which only watches ingresses, services and endpoints in the given namespaces,
+// with an informer per namespace, so it only needs access to them in those namespaces. Namespaces aren't
+// watched, so namespace selectors aren't supported. Every namespace is watched if namespaces is empty.
+func NewNamespaced(kubeconfig string, resyncPeriod time.Duration, namespaces []string) (Client, error) {
 	clientConfig, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
 	if err != nil {
 		return nil, err
@@ -86,30 +168,100 @@ func New(kubeconfig string, resyncPeriod time.Duration) (Client, error) {
 		return nil, err
 	}
 
-	return &client{clientset: clientset, resyncPeriod: resyncPeriod}, nil
+	return newClient(clientset, resyncPeriod, namespaces), nil
+}
+
+func newClient(clientset kubernetes.Interface, resyncPeriod time.Duration, namespaces []string) *client {
+	c := &client{
+		clientset:      clientset,
+		resyncPeriod:   resyncPeriod,
+		namespaces:     namespaces,
+		clusterFactory: informers.NewSharedInformerFactory(clientset, resyncPeriod),
+		stopCh:         make(chan struct{}),
+	}
+	if len(namespaces) == 0 {
+		c.namespacedFactories = []informers.SharedInformerFactory{c.clusterFactory}
+	}
+	for _, namespace := range namespaces {
+		c.namespacedFactories = append(c.namespacedFactories,
+			informers.NewSharedInformerFactoryWithOptions(clientset, resyncPeriod, informers.WithNamespace(namespace)))
+	}
+	return c
+}
+
+// source caches a resource using a shared informer from each factory, notifying a single watcher of changes.
+type source struct {
+	informers []cache.SharedIndexInformer
+	watcher   *handlerWatcher
+}
+
+// newSource creates a source which watches the resource with the informer from each factory. Factories are
+// started, so informers run until the client is stopped.
+func (c *client) newSource(kind string, factories []informers.SharedInformerFactory,
+	informerFor func(informers.SharedInformerFactory) cache.SharedIndexInformer) *source {
+	s := &source{watcher: &handlerWatcher{bufferedWatcher: newBufferedWatcher(bufferedWatcherDuration, c.stopCh), kind: kind}}
+	for _, factory := range factories {
+		informer := informerFor(factory)
+		informer.AddEventHandler(s.watcher)
+		s.informers = append(s.informers, informer)
+		factory.Start(c.stopCh)
+	}
+	return s
+}
+
+func (s *source) hasSynced() bool {
+	for _, informer := range s.informers {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *source) list() []interface{} {
+	var objs []interface{}
+	for _, informer := range s.informers {
+		objs = append(objs, informer.GetStore().List()...)
+	}
+	return objs
 }
 
-func (c *client) GetAllIngresses() ([]*v1beta1.Ingress, error) {
+func (c *client) GetAllIngresses() ([]*networkingv1.Ingress, error) {
 	return c.GetIngresses(nil)
 }
 
-func (c *client) GetIngresses(selector *NamespaceSelector) ([]*v1beta1.Ingress, error) {
-	if !c.namespaceController.HasSynced() {
+func (c *client) GetIngresses(selector *NamespaceSelector) ([]*networkingv1.Ingress, error) {
+	if selector != nil && len(c.namespaces) > 0 {
+		return nil, errors.New("namespace selectors aren't supported when watching specific namespaces")
+	}
+
+	c.createIngressSource()
+	c.createServiceSource()
+	c.createNamespaceSource()
+
+	// Ingresses are only complete once synced, and can't be combined with their services until those are synced.
+	if !c.ingresses.hasSynced() {
+		return nil, errors.New("ingresses haven't synced yet")
+	}
+	if !c.services.hasSynced() {
+		return nil, errors.New("services haven't synced yet")
+	}
+	if !c.namespaceSource.hasSynced() {
 		return nil, errors.New("namespaces haven't synced yet")
 	}
 
-	var allIngresses []*v1beta1.Ingress
-	for _, obj := range c.ingressStore.List() {
-		allIngresses = append(allIngresses, obj.(*v1beta1.Ingress))
+	var allIngresses []*networkingv1.Ingress
+	for _, obj := range c.ingresses.list() {
+		allIngresses = append(allIngresses, obj.(*networkingv1.Ingress))
 	}
 
 	if selector == nil {
 		return allIngresses, nil
 	}
 
-	supportedNamespaces := supportedNamespaces(selector, toNamespaces(c.namespaceStore.List()))
+	supportedNamespaces := supportedNamespaces(selector, toNamespaces(c.namespaceSource.list()))
 
-	var filteredIngresses []*v1beta1.Ingress
+	var filteredIngresses []*networkingv1.Ingress
 	for _, ingress := range allIngresses {
 		if ingressInNamespace(ingress, supportedNamespaces) {
 			filteredIngresses = append(filteredIngresses, ingress)
@@ -133,17 +285,17 @@ func supportedNamespaces(selector *NamespaceSelector, namespaces []*v1.Namespace
 
 	var filteredNamespaces []*v1.Namespace
 	for _, namespace := range namespaces {
-		if val, ok := namespace.Labels[selector.LabelName]; ok && val == selector.LabelValue {
+		if selector.Matches(namespace.Labels) {
 			filteredNamespaces = append(filteredNamespaces, namespace)
 		}
 	}
-	log.Debugf("Found %d of %d namespaces that match the selector %s=%s",
-		len(filteredNamespaces), len(namespaces), selector.LabelName, selector.LabelValue)
+	log.Debugf("Found %d of %d namespaces that match the selector %v",
+		len(filteredNamespaces), len(namespaces), selector)
 
 	return filteredNamespaces
 }
 
-func ingressInNamespace(ingress *v1beta1.Ingress, namespaces []*v1.Namespace) bool {
+func ingressInNamespace(ingress *networkingv1.Ingress, namespaces []*v1.Namespace) bool {
 	for _, namespace := range namespaces {
 		if namespace.Name == ingress.Namespace {
 			return true
@@ -154,35 +306,30 @@ func ingressInNamespace(ingress *v1beta1.Ingress, namespaces []*v1.Namespace) bo
 
 func (c *client) WatchIngresses() Watcher {
 	c.createIngressSource()
-	return c.ingressWatcher
+	return c.ingresses.watcher
 }
 
 func (c *client) createIngressSource() {
 	c.Lock()
 	defer c.Unlock()
-	if c.ingressStore != nil {
+	if c.ingresses != nil {
 		return
 	}
 
-	ingressLW := cache.NewListWatchFromClient(c.clientset.ExtensionsV1beta1().RESTClient(), "ingresses", "",
-		fields.Everything())
-	c.ingressWatcher = &handlerWatcher{bufferedWatcher: newBufferedWatcher(bufferedWatcherDuration)}
-	store, controller := cache.NewInformer(ingressLW, &v1beta1.Ingress{}, c.resyncPeriod, c.ingressWatcher)
-
-	c.ingressStore = store
-	c.ingressController = controller
-	go controller.Run(make(chan struct{}))
+	c.ingresses = c.newSource(IngressKind, c.namespacedFactories, func(f informers.SharedInformerFactory) cache.SharedIndexInformer {
+		return f.Networking().V1().Ingresses().Informer()
+	})
 }
 
 func (c *client) GetServices() ([]*v1.Service, error) {
 	c.createServiceSource()
 
-	if !c.serviceController.HasSynced() {
+	if !c.services.hasSynced() {
 		return nil, errors.New("services haven't synced yet")
 	}
 
 	var services []*v1.Service
-	for _, obj := range c.serviceStore.List() {
+	for _, obj := range c.services.list() {
 		services = append(services, obj.(*v1.Service))
 	}
 
@@ -191,82 +338,234 @@ func (c *client) GetServices() ([]*v1.Service, error) {
 
 func (c *client) WatchServices() Watcher {
 	c.createServiceSource()
-	return c.serviceWatcher
+	return c.services.watcher
 }
 
 func (c *client) createServiceSource() {
 	c.Lock()
 	defer c.Unlock()
-	if c.serviceStore != nil {
+	if c.services != nil {
 		return
 	}
 
-	serviceLW := cache.NewListWatchFromClient(c.clientset.CoreV1().RESTClient(), "services", "", fields.Everything())
-	c.serviceWatcher = &handlerWatcher{bufferedWatcher: newBufferedWatcher(bufferedWatcherDuration)}
-	store, controller := cache.NewInformer(serviceLW, &v1.Service{}, c.resyncPeriod, c.serviceWatcher)
-
-	c.serviceStore = store
-	c.serviceController = controller
-	go controller.Run(make(chan struct{}))
+	c.services = c.newSource(ServiceKind, c.namespacedFactories, func(f informers.SharedInformerFactory) cache.SharedIndexInformer {
+		return f.Core().V1().Services().Informer()
+	})
 }
 
+// WatchNamespaces never notifies when watching specific namespaces, as namespaces aren't watched.
 func (c *client) WatchNamespaces() Watcher {
 	c.createNamespaceSource()
-	return c.namespaceWatcher
+	return c.namespaceSource.watcher
 }
 
 func (c *client) createNamespaceSource() {
 	c.Lock()
 	defer c.Unlock()
-	if c.namespaceStore != nil {
+	if c.namespaceSource != nil {
 		return
 	}
 
-	namespaceLW := cache.NewListWatchFromClient(
-		c.clientset.CoreV1().RESTClient(), "namespaces", "", fields.Everything())
-	c.namespaceWatcher = &handlerWatcher{bufferedWatcher: newBufferedWatcher(bufferedWatcherDuration)}
-	store, controller := cache.NewInformer(namespaceLW, &v1.Namespace{}, c.resyncPeriod, c.namespaceWatcher)
+	var factories []informers.SharedInformerFactory
+	if len(c.namespaces) == 0 {
+		factories = []informers.SharedInformerFactory{c.clusterFactory}
+	}
+	c.namespaceSource = c.newSource(NamespaceKind, factories, func(f informers.SharedInformerFactory) cache.SharedIndexInformer {
+		return f.Core().V1().Namespaces().Informer()
+	})
+}
+
+func (c *client) GetEndpoints() ([]*v1.Endpoints, error) {
+	c.createEndpointsSource()
+
+	if !c.endpoints.hasSynced() {
+		return nil, errors.New("endpoints haven't synced yet")
+	}
+
+	var endpoints []*v1.Endpoints
+	for _, obj := range c.endpoints.list() {
+		endpoints = append(endpoints, obj.(*v1.Endpoints))
+	}
 
-	c.namespaceStore = store
-	c.namespaceController = controller
-	go controller.Run(make(chan struct{}))
+	return endpoints, nil
 }
 
-func (c *client) UpdateIngressStatus(ingress *v1beta1.Ingress) error {
-	ingressClient := c.clientset.ExtensionsV1beta1().Ingresses(ingress.Namespace)
+func (c *client) WatchEndpoints() Watcher {
+	c.createEndpointsSource()
+	return c.endpoints.watcher
+}
 
-	currentIng, err := ingressClient.Get(ingress.Name, metav1.GetOptions{})
+func (c *client) createEndpointsSource() {
+	c.Lock()
+	defer c.Unlock()
+	if c.endpoints != nil {
+		return
+	}
+
+	c.endpoints = c.newSource(EndpointsKind, c.namespacedFactories, func(f informers.SharedInformerFactory) cache.SharedIndexInformer {
+		return f.Core().V1().Endpoints().Informer()
+	})
+}
+
+func (c *client) GetIngressClasses() ([]*networkingv1.IngressClass, error) {
+	c.createIngressClassSource()
+
+	if !c.ingressClasses.hasSynced() {
+		return nil, errors.New("ingress classes haven't synced yet")
+	}
+
+	var ingressClasses []*networkingv1.IngressClass
+	for _, obj := range c.ingressClasses.list() {
+		ingressClasses = append(ingressClasses, obj.(*networkingv1.IngressClass))
+	}
+
+	return ingressClasses, nil
+}
+
+func (c *client) WatchIngressClasses() Watcher {
+	c.createIngressClassSource()
+	return c.ingressClasses.watcher
+}
+
+func (c *client) createIngressClassSource() {
+	c.Lock()
+	defer c.Unlock()
+	if c.ingressClasses != nil {
+		return
+	}
+
+	// IngressClasses are cluster scoped, so are watched across the cluster even when watching specific namespaces.
+	c.ingressClasses = c.newSource(IngressClassKind, []informers.SharedInformerFactory{c.clusterFactory},
+		func(f informers.SharedInformerFactory) cache.SharedIndexInformer {
+			return f.Networking().V1().IngressClasses().Informer()
+		})
+}
+
+func (c *client) GetSecrets() ([]*v1.Secret, error) {
+	c.createSecretSource()
+
+	if !c.secrets.hasSynced() {
+		return nil, errors.New("secrets haven't synced yet")
+	}
+
+	var secrets []*v1.Secret
+	for _, obj := range c.secrets.list() {
+		secrets = append(secrets, obj.(*v1.Secret))
+	}
+
+	return secrets, nil
+}
+
+func (c *client) WatchSecrets() Watcher {
+	c.createSecretSource()
+	return c.secrets.watcher
+}
+
+func (c *client) createSecretSource() {
+	c.Lock()
+	defer c.Unlock()
+	if c.secrets != nil {
+		return
+	}
+
+	// Secrets have their own factories, to only cache TLS secrets rather than every secret in the cluster.
+	tlsOnly := informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		options.FieldSelector = fields.OneTermEqualSelector("type", string(v1.SecretTypeTLS)).String()
+	})
+	var factories []informers.SharedInformerFactory
+	if len(c.namespaces) == 0 {
+		factories = append(factories, informers.NewSharedInformerFactoryWithOptions(c.clientset, c.resyncPeriod, tlsOnly))
+	}
+	for _, namespace := range c.namespaces {
+		factories = append(factories, informers.NewSharedInformerFactoryWithOptions(c.clientset, c.resyncPeriod,
+			tlsOnly, informers.WithNamespace(namespace)))
+	}
+
+	c.secrets = c.newSource(SecretKind, factories, func(f informers.SharedInformerFactory) cache.SharedIndexInformer {
+		return f.Core().V1().Secrets().Informer()
+	})
+}
+
+func (c *client) UpdateIngressStatus(ingress *networkingv1.Ingress) error {
+	ingressClient := c.clientset.NetworkingV1().Ingresses(ingress.Namespace)
+
+	currentIng, err := ingressClient.Get(context.TODO(), ingress.Name, metav1.GetOptions{})
 	if err != nil {
 		return err
 	}
 
 	currentIng.Status.LoadBalancer.Ingress = ingress.Status.LoadBalancer.Ingress
 
-	_, err = ingressClient.UpdateStatus(currentIng)
+	_, err = ingressClient.UpdateStatus(context.TODO(), currentIng, metav1.UpdateOptions{})
 
 	return err
 }
 
+func (c *client) EventRecorder(component string) record.EventRecorder {
+	c.createEventBroadcaster()
+	return c.eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: component})
+}
+
+func (c *client) createEventBroadcaster() {
+	c.Lock()
+	defer c.Unlock()
+	if c.eventBroadcaster != nil {
+		return
+	}
+
+	c.eventBroadcaster = record.NewBroadcaster()
+	c.eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: c.clientset.CoreV1().Events("")})
+}
+
+func (c *client) LeaseLock(namespace, name, identity string) resourcelock.Interface {
+	return &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Client:    c.clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: identity,
+		},
+	}
+}
+
+func (c *client) Stop() {
+	c.Lock()
+	defer c.Unlock()
+	if c.stopped {
+		return
+	}
+	c.stopped = true
+
+	close(c.stopCh)
+	if c.eventBroadcaster != nil {
+		c.eventBroadcaster.Shutdown()
+	}
+}
+
 // Implement cache.ResourceEventHandler
 type handlerWatcher struct {
 	*bufferedWatcher
+	kind string
 }
 
-func (w *handlerWatcher) notify() {
-	w.bufferUpdate()
+func (w *handlerWatcher) notify(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		log.Warnf("Unable to get the key of %s %v: %v", w.kind, obj, err)
+	}
+	w.bufferUpdate(Change{Kind: w.kind, Key: key})
 }
 
 func (w *handlerWatcher) OnAdd(obj interface{}) {
 	log.Debugf("OnAdd called for %v - updating watcher", obj)
-	go w.notify()
+	w.notify(obj)
 }
 
 func (w *handlerWatcher) OnUpdate(old interface{}, new interface{}) {
 	log.Debugf("OnUpdate called for %v to %v - updating watcher", old, new)
-	go w.notify()
+	w.notify(new)
 }
 
 func (w *handlerWatcher) OnDelete(obj interface{}) {
 	log.Debugf("OnDelete called for %v - updating watcher", obj)
-	go w.notify()
+	w.notify(obj)
 }
@@ -0,0 +1,200 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestNamespaceSelectorSupportsLabelSelectorSyntax(t *testing.T) {
+	asserter := assert.New(t)
+	namespaces := []*v1.Namespace{
+		namespace("a", map[string]string{"team": "a"}),
+		namespace("b", map[string]string{"team": "b", "deprecated": "true"}),
+		namespace("c", map[string]string{"team": "c"}),
+		namespace("d", nil),
+	}
+
+	var tests = []struct {
+		selector string
+		expected []string
+	}{
+		{"team=a", []string{"a"}},
+		{"team!=a", []string{"b", "c", "d"}},
+		{"team in (a,b)", []string{"a", "b"}},
+		{"team notin (a,b)", []string{"c", "d"}},
+		{"!deprecated", []string{"a", "c", "d"}},
+		{"team,!deprecated", []string{"a", "c"}},
+		{"team in (a,b),!deprecated", []string{"a"}},
+	}
+
+	for _, test := range tests {
+		selector, err := ParseNamespaceSelector(test.selector)
+		asserter.NoError(err, test.selector)
+
+		var names []string
+		for _, namespace := range supportedNamespaces(selector, namespaces) {
+			names = append(names, namespace.Name)
+		}
+		asserter.Equal(test.expected, names, test.selector)
+	}
+}
+
+func TestNamespaceSelectorSupportsLegacyLabelNameAndValue(t *testing.T) {
+	selector := &NamespaceSelector{LabelName: "team", LabelValue: "a"}
+
+	assert.True(t, selector.Matches(map[string]string{"team": "a"}))
+	assert.False(t, selector.Matches(map[string]string{"team": "b"}))
+	assert.False(t, selector.Matches(nil))
+}
+
+func TestParseNamespaceSelector(t *testing.T) {
+	asserter := assert.New(t)
+
+	selector, err := ParseNamespaceSelector("")
+	asserter.NoError(err)
+	asserter.Nil(selector)
+
+	for _, invalid := range []string{"team=a=b", "team in a", "=a", "!"} {
+		_, err := ParseNamespaceSelector(invalid)
+		asserter.Error(err, invalid)
+	}
+}
+
+func TestClientOnlyWatchesGivenNamespaces(t *testing.T) {
+	asserter := assert.New(t)
+	clientset := fake.NewSimpleClientset(service("a", "svc"), service("b", "svc"), service("c", "svc"))
+	c := newClient(clientset, 0, []string{"a", "b"})
+	c.WatchServices()
+	c.WatchNamespaces()
+
+	var services []*v1.Service
+	asserter.Eventually(func() bool {
+		var err error
+		services, err = c.GetServices()
+		return err == nil
+	}, time.Second, smallWaitTime)
+
+	var namespaces []string
+	for _, svc := range services {
+		namespaces = append(namespaces, svc.Namespace)
+	}
+	asserter.ElementsMatch([]string{"a", "b"}, namespaces)
+	asserter.True(c.namespaceSource.hasSynced(), "namespaces aren't watched")
+	for _, action := range clientset.Actions() {
+		asserter.NotEqual("namespaces", action.GetResource().Resource)
+	}
+}
+
+func TestWatcherNotifiesWithChangedResources(t *testing.T) {
+	asserter := assert.New(t)
+	clientset := fake.NewSimpleClientset()
+	c := newClient(clientset, 0, nil)
+	watcher := c.WatchServices()
+	asserter.Eventually(c.services.hasSynced, time.Second, smallWaitTime)
+
+	_, err := clientset.CoreV1().Services("a").Create(context.TODO(), service("a", "svc"), metav1.CreateOptions{})
+	asserter.NoError(err)
+
+	select {
+	case update := <-watcher.Updates():
+		asserter.Equal(Changes{{Kind: ServiceKind, Key: "a/svc"}}, update)
+	case <-time.After(time.Second):
+		asserter.Fail("watcher wasn't notified")
+	}
+}
+
+func TestWatchersStopWhenClientIsStopped(t *testing.T) {
+	asserter := assert.New(t)
+	clientset := fake.NewSimpleClientset()
+	c := newClient(clientset, 0, nil)
+	watcher := c.WatchServices()
+	asserter.Eventually(c.services.hasSynced, time.Second, smallWaitTime)
+
+	c.Stop()
+	c.Stop()
+	_, err := clientset.CoreV1().Services("a").Create(context.TODO(), service("a", "svc"), metav1.CreateOptions{})
+	asserter.NoError(err)
+	time.Sleep(bufferedWatcherDuration * 2)
+
+	select {
+	case update := <-watcher.Updates():
+		asserter.Fail("unexpected update after stopping", "%v", update)
+	default:
+	}
+}
+
+func TestClientOnlyListsTLSSecrets(t *testing.T) {
+	asserter := assert.New(t)
+	tlsSecret := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: "cert"}, Type: v1.SecretTypeTLS}
+	clientset := fake.NewSimpleClientset(tlsSecret)
+	c := newClient(clientset, 0, nil)
+	c.WatchSecrets()
+
+	var secrets []*v1.Secret
+	asserter.Eventually(func() bool {
+		var err error
+		secrets, err = c.GetSecrets()
+		return err == nil
+	}, time.Second, smallWaitTime)
+
+	asserter.Equal([]*v1.Secret{tlsSecret}, secrets)
+	var listed bool
+	for _, action := range clientset.Actions() {
+		if list, ok := action.(k8stesting.ListAction); ok && action.GetResource().Resource == "secrets" {
+			listed = true
+			asserter.Equal("type=kubernetes.io/tls", list.GetListRestrictions().Fields.String())
+		}
+	}
+	asserter.True(listed, "secrets should be listed")
+}
+
+func TestNamespaceSelectorIsNotSupportedWhenWatchingSpecificNamespaces(t *testing.T) {
+	c := &client{namespaces: []string{"a", "b"}}
+	selector, _ := ParseNamespaceSelector("team=a")
+
+	_, err := c.GetIngresses(selector)
+
+	assert.EqualError(t, err, "namespace selectors aren't supported when watching specific namespaces")
+}
+
+func TestIngressesAreNotReturnedUntilIngressesAndServicesHaveSynced(t *testing.T) {
+	asserter := assert.New(t)
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: "ingress"}}
+	clientset := fake.NewSimpleClientset(ingress, service("a", "svc"))
+	release := make(chan struct{})
+	clientset.PrependReactor("list", "ingresses", func(k8stesting.Action) (bool, runtime.Object, error) {
+		<-release
+		return false, nil, nil
+	})
+	c := newClient(clientset, 0, []string{"a"})
+	defer c.Stop()
+
+	_, err := c.GetAllIngresses()
+	asserter.EqualError(err, "ingresses haven't synced yet")
+
+	close(release)
+	var ingresses []*networkingv1.Ingress
+	asserter.Eventually(func() bool {
+		ingresses, err = c.GetAllIngresses()
+		return err == nil
+	}, time.Second, smallWaitTime)
+	asserter.Equal([]*networkingv1.Ingress{ingress}, ingresses)
+	asserter.True(c.services.hasSynced())
+}
+
+func namespace(name string, labels map[string]string) *v1.Namespace {
+	return &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func service(namespace, name string) *v1.Service {
+	return &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+}
@@ -0,0 +1,182 @@
+package status
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/k8s"
+	"k8s.io/client-go/tools/leaderelection"
+)
+
+// LeaderElectionConfig for electing the replica which updates ingress statuses.
+type LeaderElectionConfig struct {
+	// Namespace and Name of the Lease used as the lock. Replicas sharing the Lease elect a single leader.
+	Namespace string
+	Name      string
+	// Identity of this replica, which must be unique between replicas.
+	Identity         string
+	LeaseDuration    time.Duration
+	RenewDeadline    time.Duration
+	RetryPeriod      time.Duration
+	KubernetesClient k8s.Client
+}
+
+// NewLeaderElected wraps a status updater so that it only updates ingress statuses while this replica is the
+// elected leader. Other replicas keep the latest entries, and apply them if they become the leader.
+func NewLeaderElected(updater controller.Updater, conf LeaderElectionConfig) (controller.Updater, error) {
+	initMetrics()
+	lock := conf.KubernetesClient.LeaseLock(conf.Namespace, conf.Name, conf.Identity)
+	e := &leaderElected{updater: updater, done: make(chan struct{}), retryBackoff: conf.RetryPeriod}
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   conf.LeaseDuration,
+		RenewDeadline:   conf.RenewDeadline,
+		RetryPeriod:     conf.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            conf.Name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: e.startedLeading,
+			OnStoppedLeading: e.stoppedLeading,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create leader election: %v", err)
+	}
+	e.elector = elector
+	return e, nil
+}
+
+type leaderElected struct {
+	sync.Mutex
+	updater controller.Updater
+	elector *leaderelection.LeaderElector
+	cancel  context.CancelFunc
+	done    chan struct{}
+	leading bool
+	// latest are the entries of the latest update, applied when this replica becomes the leader.
+	latest controller.IngressEntries
+	// applied is true once the wrapped updater has applied latest.
+	applied bool
+	// retryBackoff is how long to wait before retrying latest after failing to apply it on becoming the leader.
+	// It doubles with each consecutive failure.
+	retryBackoff time.Duration
+}
+
+func (e *leaderElected) String() string {
+	if s, ok := e.updater.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", e.updater)
+}
+
+// Start starts the wrapped updater, then runs for election until stopped.
+func (e *leaderElected) Start() error {
+	if err := e.updater.Start(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	go func() {
+		defer close(e.done)
+		// Run returns when leadership is lost, so keep running for election until stopped.
+		for ctx.Err() == nil {
+			e.elector.Run(ctx)
+		}
+	}()
+	return nil
+}
+
+// Stop releases the lease if leading, so another replica can take over without waiting for it to expire.
+func (e *leaderElected) Stop() error {
+	if e.cancel != nil {
+		e.cancel()
+		<-e.done
+	}
+	return e.updater.Stop()
+}
+
+func (e *leaderElected) Health() error {
+	return e.updater.Health()
+}
+
+func (e *leaderElected) Update(entries controller.IngressEntries) error {
+	e.Lock()
+	defer e.Unlock()
+	e.latest = entries
+	e.applied = false
+	if !e.leading {
+		return nil
+	}
+	err := e.updater.Update(entries)
+	e.applied = err == nil
+	return err
+}
+
+// startedLeading is called in its own goroutine, so may run after leadership was already lost and ctx cancelled.
+// The latest entries are retried with backoff until applied, as the controller only calls Update again when they
+// change.
+func (e *leaderElected) startedLeading(ctx context.Context) {
+	if !e.lead(ctx) {
+		return
+	}
+	for backoff := e.retryBackoff; ; backoff *= 2 {
+		if backoff > controller.DefaultUpdateRetryMaxBackoff {
+			backoff = controller.DefaultUpdateRetryMaxBackoff
+		}
+		if e.applyLatest(ctx) {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// lead marks this replica as the leader, returning false if leadership was already lost.
+func (e *leaderElected) lead(ctx context.Context) bool {
+	e.Lock()
+	defer e.Unlock()
+	if ctx.Err() != nil {
+		return false
+	}
+	log.Info("Elected leader, updating ingress statuses")
+	e.leading = true
+	// Another leader may have changed the statuses since they were last applied.
+	e.applied = false
+	leaderGauge.Set(1)
+	return true
+}
+
+// applyLatest applies the latest entries if they haven't been, returning false if they failed to apply.
+func (e *leaderElected) applyLatest(ctx context.Context) bool {
+	e.Lock()
+	defer e.Unlock()
+	if ctx.Err() != nil || !e.leading || e.applied || e.latest == nil {
+		return true
+	}
+	if err := e.updater.Update(e.latest); err != nil {
+		log.Warnf("Unable to update ingress statuses after being elected leader, retrying: %v", err)
+		return false
+	}
+	e.applied = true
+	return true
+}
+
+// stoppedLeading is called whenever the elector stops running, even if this replica never led.
+func (e *leaderElected) stoppedLeading() {
+	e.Lock()
+	defer e.Unlock()
+	if !e.leading {
+		return
+	}
+	log.Info("No longer the leader, stopped updating ingress statuses")
+	e.leading = false
+	leaderGauge.Set(0)
+}
@@ -0,0 +1,125 @@
+package status
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/util/metrics"
+	fake "github.com/sky-uk/feed/util/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	coordinationv1 "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
+type recordingUpdater struct {
+	sync.Mutex
+	updates []controller.IngressEntries
+	stopped bool
+	// failures is the number of updates to fail before succeeding
+	failures int
+}
+
+func (u *recordingUpdater) Start() error  { return nil }
+func (u *recordingUpdater) Health() error { return nil }
+
+func (u *recordingUpdater) Stop() error {
+	u.Lock()
+	defer u.Unlock()
+	u.stopped = true
+	return nil
+}
+
+func (u *recordingUpdater) Update(entries controller.IngressEntries) error {
+	u.Lock()
+	defer u.Unlock()
+	if u.failures > 0 {
+		u.failures--
+		return errors.New("update failed")
+	}
+	u.updates = append(u.updates, entries)
+	return nil
+}
+
+func (u *recordingUpdater) String() string { return "recording" }
+
+func (u *recordingUpdater) updateCount() int {
+	u.Lock()
+	defer u.Unlock()
+	return len(u.updates)
+}
+
+func newLeaderElectedReplica(t *testing.T, leases coordinationv1.LeasesGetter, identity string) (controller.Updater,
+	*recordingUpdater) {
+	client := &fake.FakeClient{}
+	client.On("LeaseLock", "kube-system", "feed-status", identity).Return(&resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Namespace: "kube-system", Name: "feed-status"},
+		Client:     leases,
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	})
+
+	updater := &recordingUpdater{}
+	elected, err := NewLeaderElected(updater, LeaderElectionConfig{
+		Namespace:        "kube-system",
+		Name:             "feed-status",
+		Identity:         identity,
+		LeaseDuration:    time.Second,
+		RenewDeadline:    time.Millisecond * 500,
+		RetryPeriod:      time.Millisecond * 50,
+		KubernetesClient: client,
+	})
+	require.NoError(t, err)
+	return elected, updater
+}
+
+func TestOnlyTheLeaderUpdatesStatuses(t *testing.T) {
+	leases := k8sfake.NewSimpleClientset().CoordinationV1()
+	first, firstUpdater := newLeaderElectedReplica(t, leases, "first")
+	second, secondUpdater := newLeaderElectedReplica(t, leases, "second")
+
+	entries := createDefaultIngresses()
+	require.NoError(t, first.Start())
+	require.Eventually(t, func() bool {
+		return first.Update(entries) == nil && firstUpdater.updateCount() > 0
+	}, time.Second*5, time.Millisecond*10, "first replica should be elected leader")
+	require.NoError(t, second.Start())
+	defer second.Stop()
+
+	assert.NoError(t, second.Update(entries))
+	assert.Equal(t, 0, secondUpdater.updateCount(), "other replicas shouldn't update statuses")
+
+	assert.NoError(t, first.Stop())
+	assert.True(t, firstUpdater.stopped)
+	assert.Eventually(t, func() bool { return secondUpdater.updateCount() == 1 }, time.Second*5, time.Millisecond*10,
+		"new leader should apply the latest entries")
+}
+
+func TestNewLeaderRetriesLatestEntriesUntilApplied(t *testing.T) {
+	leases := k8sfake.NewSimpleClientset().CoordinationV1()
+	elected, updater := newLeaderElectedReplica(t, leases, "first")
+	updater.failures = 2
+
+	require.NoError(t, elected.Update(createDefaultIngresses()))
+	require.NoError(t, elected.Start())
+	defer elected.Stop()
+
+	assert.Eventually(t, func() bool { return updater.updateCount() == 1 }, time.Second*5, time.Millisecond*10,
+		"new leader should retry the latest entries")
+}
+
+func TestLeaderElectedIsNamedAfterTheWrappedUpdater(t *testing.T) {
+	elected, _ := newLeaderElectedReplica(t, k8sfake.NewSimpleClientset().CoordinationV1(), "first")
+
+	assert.Equal(t, "recording", fmt.Sprint(elected))
+}
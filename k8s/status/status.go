@@ -55,7 +55,7 @@ func statusUnchanged(existing, new []v1.LoadBalancerIngress) bool {
 	sortLoadBalancerStatus(existing)
 	sortLoadBalancerStatus(new)
 	for i, loadbalancer := range existing {
-		if loadbalancer != new[i] {
+		if loadbalancer.IP != new[i].IP || loadbalancer.Hostname != new[i].Hostname {
 			return false
 		}
 	}
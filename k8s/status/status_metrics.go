@@ -0,0 +1,18 @@
+package status
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/util/metrics"
+)
+
+var once sync.Once
+var leaderGauge prometheus.Gauge
+
+func initMetrics() {
+	once.Do(func() {
+		leaderGauge = metrics.RegisterNewDefaultGauge(metrics.PrometheusIngressSubsystem,
+			"status_leader", "1 if this replica is the elected leader which updates ingress statuses, 0 otherwise.")
+	})
+}
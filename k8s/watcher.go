@@ -10,10 +10,31 @@ import (
 // Watcher provides channels for receiving updates. It tries its best to run forever, retrying
 // if the underlying connection fails.
 type Watcher interface {
-	// Updates provides update notification.
+	// Updates provides update notification. Watchers of a Client send Changes.
 	Updates() <-chan interface{}
 }
 
+// Kinds of the resources watched by a Client.
+const (
+	IngressKind      = "Ingress"
+	ServiceKind      = "Service"
+	NamespaceKind    = "Namespace"
+	EndpointsKind    = "Endpoints"
+	IngressClassKind = "IngressClass"
+	SecretKind       = "Secret"
+)
+
+// Change identifies a watched resource which was added, updated or deleted.
+type Change struct {
+	// Kind of the resource, such as ServiceKind.
+	Kind string
+	// Key is the namespace/name of the resource, or its name if it's cluster scoped. Empty if unknown.
+	Key string
+}
+
+// Changes are the resources changed since the previous update of a watcher.
+type Changes []Change
+
 type baseWatcher struct {
 	updates chan interface{}
 }
@@ -40,35 +61,56 @@ func (w *watcher) Updates() <-chan interface{} {
 
 type bufferedWatcher struct {
 	*watcher
-	shouldUpdate bool
+	pending  Changes
+	buffered map[Change]bool
+	stopCh   <-chan struct{}
 	sync.Mutex
 }
 
-func newBufferedWatcher(bufferTime time.Duration) *bufferedWatcher {
-	b := &bufferedWatcher{watcher: newWatcher()}
+// newBufferedWatcher sends the buffered changes every bufferTime, until stopCh is closed.
+func newBufferedWatcher(bufferTime time.Duration, stopCh <-chan struct{}) *bufferedWatcher {
+	b := &bufferedWatcher{watcher: newWatcher(), buffered: make(map[Change]bool), stopCh: stopCh}
 
 	go func() {
-		tick := time.Tick(bufferTime)
-		for range tick {
-			b.sendUpdate()
+		ticker := time.NewTicker(bufferTime)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				b.sendUpdate()
+			case <-stopCh:
+				return
+			}
 		}
 	}()
 
 	return b
 }
 
-func (b *bufferedWatcher) bufferUpdate() {
+// bufferUpdate adds the change to the next update, unless it's already included.
+func (b *bufferedWatcher) bufferUpdate(change Change) {
 	b.Lock()
 	defer b.Unlock()
-	b.shouldUpdate = true
+	if b.buffered[change] {
+		return
+	}
+	b.buffered[change] = true
+	b.pending = append(b.pending, change)
 }
 
 func (b *bufferedWatcher) sendUpdate() {
 	b.Lock()
 	defer b.Unlock()
-	if b.shouldUpdate {
-		b.shouldUpdate = false
-		go func() { b.updates <- struct{}{} }()
+	if len(b.pending) > 0 {
+		changes := b.pending
+		b.pending = nil
+		b.buffered = make(map[Change]bool)
+		go func() {
+			select {
+			case b.updates <- changes:
+			case <-b.stopCh:
+			}
+		}()
 	}
 }
 
@@ -79,7 +121,13 @@ type combinedWatcher struct {
 
 // CombineWatchers returns a watcher that watches all. The combined watcher becomes the owner
 // of the passed in watchers and so clients should not attempt to use or stop the individual watchers.
+// It watches forever, so use CombineWatchersUntil if it needs to be stopped.
 func CombineWatchers(watchers ...Watcher) Watcher {
+	return CombineWatchersUntil(nil, watchers...)
+}
+
+// CombineWatchersUntil returns a watcher that watches all until stopCh is closed, like CombineWatchers.
+func CombineWatchersUntil(stopCh <-chan struct{}, watchers ...Watcher) Watcher {
 	combined := &combinedWatcher{baseWatcher: newBaseWatcher(), watchers: watchers}
 
 	combiner := func(w Watcher) {
@@ -89,7 +137,13 @@ func CombineWatchers(watchers ...Watcher) Watcher {
 				if update == nil {
 					log.Panic("update should not be nil, did you close the watcher?")
 				}
-				combined.updates <- update
+				select {
+				case combined.updates <- update:
+				case <-stopCh:
+					return
+				}
+			case <-stopCh:
+				return
 			}
 		}
 	}
@@ -1,6 +1,7 @@
 package k8s
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -31,21 +32,25 @@ func TestWatcherUpdates(t *testing.T) {
 func TestBufferedWatcherBuffersUpdates(t *testing.T) {
 	asserter := assert.New(t)
 
-	b := newBufferedWatcher(smallWaitTime)
-	defer close(b.updates)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	b := newBufferedWatcher(smallWaitTime, stopCh)
 	timesCalled := &util.SafeInt{}
+	received := make(chan interface{}, 10)
 	go func() {
-		for range b.Updates() {
+		for update := range b.Updates() {
 			timesCalled.Add(1)
+			received <- update
 		}
 	}()
 
 	for i := 0; i < 10; i++ {
-		b.bufferUpdate()
+		b.bufferUpdate(Change{Kind: ServiceKind, Key: fmt.Sprintf("default/svc-%d", i%2)})
 	}
 	time.Sleep(smallWaitTime * 2)
 
 	asserter.Equal(1, timesCalled.Get())
+	asserter.Equal(Changes{{Kind: ServiceKind, Key: "default/svc-0"}, {Kind: ServiceKind, Key: "default/svc-1"}}, <-received)
 }
 
 func TestCombinedWatcherUpdates(t *testing.T) {
@@ -68,3 +73,41 @@ func TestCombinedWatcherUpdates(t *testing.T) {
 
 	asserter.Equal(3, called.Get())
 }
+
+func TestBufferedWatcherStopsSendingUpdates(t *testing.T) {
+	stopCh := make(chan struct{})
+	b := newBufferedWatcher(smallWaitTime, stopCh)
+
+	close(stopCh)
+	b.bufferUpdate(Change{Kind: IngressKind, Key: "default/ingress"})
+	time.Sleep(smallWaitTime * 2)
+
+	select {
+	case update := <-b.Updates():
+		assert.Fail(t, "unexpected update after stopping", "%v", update)
+	default:
+	}
+}
+
+func TestCombinedWatcherStopsCombining(t *testing.T) {
+	asserter := assert.New(t)
+
+	stopCh := make(chan struct{})
+	w := newWatcher()
+	cw := CombineWatchersUntil(stopCh, w)
+
+	w.updates <- struct{}{}
+	asserter.Equal(struct{}{}, <-cw.Updates())
+
+	close(stopCh)
+	time.Sleep(smallWaitTime)
+	w.updates <- struct{}{}
+	time.Sleep(smallWaitTime)
+
+	select {
+	case update := <-cw.Updates():
+		asserter.Fail("unexpected update after stopping", "%v", update)
+	default:
+	}
+	asserter.Len(w.updates, 1, "update shouldn't be consumed after stopping")
+}
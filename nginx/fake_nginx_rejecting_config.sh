@@ -0,0 +1,9 @@
+#!/usr/bin/env bash
+
+# Rejects any config containing the reject.me host, otherwise behaves like fake_graceful_nginx.py.
+if [[ "$1" == "-t" ]] && grep -q "reject.me" "$3"; then
+    echo "Config check failed" >&2
+    exit 1
+fi
+
+exec "$(dirname $0)/fake_graceful_nginx.py" "$@"
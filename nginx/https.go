@@ -0,0 +1,96 @@
+package nginx
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// hstsMap sets Variable to a Strict-Transport-Security header value if https was used, and leaves it empty
+// otherwise. A map chooses the value, as if in a location breaks proxy_pass of stripped paths.
+type hstsMap struct {
+	Variable string
+	Value    string
+}
+
+// httpsRedirect is the redirect code of the locations matching Pattern, a regex of the request uri. Code is 0 for
+// locations which aren't redirected, so they keep precedence over shorter prefixes which are.
+type httpsRedirect struct {
+	Pattern string
+	Code    int
+}
+
+// setHSTSVariables sets the HSTS variable of every location, returning a map for each distinct header value.
+func setHSTSVariables(servers []*server) []*hstsMap {
+	variables := make(map[string]string)
+	for _, s := range servers {
+		for _, l := range s.Locations {
+			if l.HSTS != "" {
+				variables[l.HSTS] = ""
+			}
+		}
+	}
+
+	values := make([]string, 0, len(variables))
+	for value := range variables {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	maps := make([]*hstsMap, len(values))
+	for i, value := range values {
+		maps[i] = &hstsMap{Variable: fmt.Sprintf("$hsts_%d", i), Value: value}
+		variables[value] = maps[i].Variable
+	}
+
+	for _, s := range servers {
+		for _, l := range s.Locations {
+			l.HSTSVariable = variables[l.HSTS]
+		}
+	}
+	return maps
+}
+
+// setHTTPSRedirects sets the redirects of every server with a location redirecting to https. nginx chooses the
+// location by the longest matching prefix, unless one matches the uri exactly, so the redirects are in that order
+// for the map of the server to match the same location.
+func setHTTPSRedirects(servers []*server) {
+	for i, s := range servers {
+		codes := make(map[int]bool)
+		for _, l := range s.Locations {
+			if l.HTTPSRedirectCode != 0 {
+				codes[l.HTTPSRedirectCode] = true
+			}
+		}
+		if len(codes) == 0 {
+			continue
+		}
+
+		for code := range codes {
+			s.HTTPSRedirectCodes = append(s.HTTPSRedirectCodes, code)
+		}
+		sort.Ints(s.HTTPSRedirectCodes)
+		s.HTTPSRedirectVariable = fmt.Sprintf("$https_redirect_%d", i)
+
+		ordered := make([]*location, len(s.Locations))
+		copy(ordered, s.Locations)
+		sort.SliceStable(ordered, func(i, j int) bool {
+			if ordered[i].ExactPath != ordered[j].ExactPath {
+				return ordered[i].ExactPath
+			}
+			return len(ordered[i].Path) > len(ordered[j].Path)
+		})
+		for _, l := range ordered {
+			pattern := quoteMapRegex(l.Path)
+			if l.ExactPath {
+				pattern += "$"
+			}
+			s.HTTPSRedirects = append(s.HTTPSRedirects, &httpsRedirect{Pattern: pattern, Code: l.HTTPSRedirectCode})
+		}
+	}
+}
+
+// quoteMapRegex escapes a path for a regex in a double quoted key of an nginx map.
+func quoteMapRegex(path string) string {
+	return strings.Replace(regexp.QuoteMeta(path), `"`, `\"`, -1)
+}
@@ -0,0 +1,242 @@
+package nginx
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sky-uk/feed/controller"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPSRedirectsMatchTheLocationNginxChooses(t *testing.T) {
+	s := &server{Locations: []*location{
+		{Path: "/", HTTPSRedirectCode: 308},
+		{Path: "/api/"},
+		{Path: "/api/v1.0/", HTTPSRedirectCode: 301},
+		{Path: "/exact", ExactPath: true},
+	}}
+
+	setHTTPSRedirects([]*server{{}, s})
+
+	assert.Equal(t, "$https_redirect_1", s.HTTPSRedirectVariable)
+	assert.Equal(t, []int{301, 308}, s.HTTPSRedirectCodes)
+	assert.Equal(t, []*httpsRedirect{
+		{Pattern: "/exact$", Code: 0},
+		{Pattern: `/api/v1\.0/`, Code: 301},
+		{Pattern: "/api/", Code: 0},
+		{Pattern: "/", Code: 308},
+	}, s.HTTPSRedirects)
+}
+
+func TestServersWithoutHTTPSRedirectsHaveNoRedirectMap(t *testing.T) {
+	s := &server{Locations: []*location{{Path: "/"}}}
+
+	setHTTPSRedirects([]*server{s})
+
+	assert.Empty(t, s.HTTPSRedirectVariable)
+	assert.Empty(t, s.HTTPSRedirects)
+}
+
+func TestHSTSHeadersShareAVariablePerValue(t *testing.T) {
+	a := &location{HSTS: "max-age=60"}
+	b := &location{HSTS: "max-age=10"}
+	c := &location{HSTS: "max-age=60"}
+	none := &location{}
+
+	maps := setHSTSVariables([]*server{{Locations: []*location{a, b}}, {Locations: []*location{c, none}}})
+
+	assert.Equal(t, []*hstsMap{{Variable: "$hsts_0", Value: "max-age=10"}, {Variable: "$hsts_1", Value: "max-age=60"}}, maps)
+	assert.Equal(t, "$hsts_1", a.HSTSVariable)
+	assert.Equal(t, "$hsts_0", b.HSTSVariable)
+	assert.Equal(t, "$hsts_1", c.HSTSVariable)
+	assert.Empty(t, none.HSTSVariable)
+}
+
+func TestOnlyTrustedFrontendsCanSkipHTTPSRedirects(t *testing.T) {
+	tmpDir := setupWorkDir(t)
+	defer os.RemoveAll(tmpDir)
+	conf := newConf(tmpDir, fakeNginx)
+	conf.TrustedFrontends = []string{"10.0.0.0/8", "192.168.0.1"}
+
+	config, err := New(conf).(*nginxUpdater).createConfig(controller.IngressEntries{})
+	require.NoError(t, err)
+
+	assert.Contains(t, string(config), "    geo $realip_remote_addr $trusted_frontend {\n"+
+		"        default 0;\n"+
+		"        10.0.0.0/8 1;\n"+
+		"        192.168.0.1 1;\n"+
+		"    }\n"+
+		"    map $trusted_frontend $trusted_frontend_scheme {\n"+
+		"        1 $frontend_scheme;\n"+
+		"        default $scheme;\n"+
+		"    }\n")
+}
+
+// The following tests run a real nginx, so are skipped unless it has the modules of the feed-ingress image.
+
+func TestRealNginxStripsPathsOfLocationsWithHSTS(t *testing.T) {
+	backend, paths := recordingBackend()
+	defer backend.Close()
+	entry := realNginxEntry(backend)
+	entry.StripPaths = true
+	entry.HSTS = true
+	entry.HSTSMaxAgeSeconds = 60
+	addr, stop := startRealNginx(t, []string{"127.0.0.1"}, entry)
+	defer stop()
+
+	resp := getFromRealNginx(t, addr, "/app/resource", "https")
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "max-age=60", resp.Header.Get("Strict-Transport-Security"))
+	assert.Equal(t, []string{"/resource"}, paths())
+}
+
+func TestRealNginxRedirectsClientsSpoofingXForwardedProto(t *testing.T) {
+	backend, paths := recordingBackend()
+	defer backend.Close()
+	entry := realNginxEntry(backend)
+	entry.HTTPSRedirect = true
+	entry.HSTS = true
+	entry.HSTSMaxAgeSeconds = 60
+	addr, stop := startRealNginx(t, []string{"10.0.0.0/8"}, entry)
+	defer stop()
+
+	resp := getFromRealNginx(t, addr, "/app/resource", "https")
+
+	assert.Equal(t, http.StatusPermanentRedirect, resp.StatusCode)
+	assert.Equal(t, "https://realnginx.com/app/resource", resp.Header.Get("Location"))
+	assert.Empty(t, resp.Header.Get("Strict-Transport-Security"))
+	assert.Empty(t, paths())
+}
+
+// recordingBackend records the paths of the requests it receives.
+func recordingBackend() (*httptest.Server, func() []string) {
+	var lock sync.Mutex
+	var paths []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		paths = append(paths, r.URL.Path)
+	}))
+	return backend, func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return paths
+	}
+}
+
+func realNginxEntry(backend *httptest.Server) controller.IngressEntry {
+	return controller.IngressEntry{
+		Namespace:             "default",
+		Name:                  "real-nginx",
+		Host:                  "realnginx.com",
+		Path:                  "/app/",
+		ServiceAddress:        "127.0.0.1",
+		ServicePort:           int32(getPort(backend)),
+		BackendTimeoutSeconds: 10,
+		ProxyBufferSize:       16,
+		ProxyBufferBlocks:     4,
+	}
+}
+
+// startRealNginx checks the config of the entries with nginx -t, then runs nginx with it until stopped,
+// returning the address of its http port.
+func startRealNginx(t *testing.T, trustedFrontends []string, entries ...controller.IngressEntry) (string, func()) {
+	binary := realNginxBinary(t)
+	tmpDir := setupWorkDir(t)
+
+	conf := newConf(tmpDir, binary)
+	conf.Ports = []Port{{Name: "http", Port: freePort(t)}}
+	conf.HealthPort = freePort(t)
+	conf.TrustedFrontends = trustedFrontends
+	conf.WorkerConnections = 64
+	conf.KeepaliveSeconds = 10
+	config, err := New(conf).(*nginxUpdater).createConfig(entries)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		require.NoError(t, err)
+	}
+	file := filepath.Join(tmpDir, "nginx.conf")
+	cmd := exec.Command(binary, "-p", tmpDir, "-c", file)
+	stop := func() {
+		if cmd.Process != nil {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		}
+		os.RemoveAll(tmpDir)
+	}
+
+	if err := ioutil.WriteFile(file, config, 0644); err != nil {
+		stop()
+		require.NoError(t, err)
+	}
+	if out, err := exec.Command(binary, "-t", "-p", tmpDir, "-c", file).CombinedOutput(); err != nil {
+		stop()
+		require.NoError(t, err, "nginx -t: %s", out)
+	}
+	if err := cmd.Start(); err != nil {
+		stop()
+		require.NoError(t, err)
+	}
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(conf.Ports[0].Port))
+	started := assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	}, 5*time.Second, smallWaitTime, "nginx didn't start")
+	if !started {
+		stop()
+		t.FailNow()
+	}
+	return addr, stop
+}
+
+// realNginxBinary returns the nginx binary, skipping the test unless it has the modules nginx.tmpl uses.
+func realNginxBinary(t *testing.T) string {
+	binary, err := exec.LookPath("nginx")
+	if err != nil {
+		t.Skip("nginx isn't installed")
+	}
+	// nginx -V prints the configure arguments, including the added modules, to stderr.
+	out, err := exec.Command(binary, "-V").CombinedOutput()
+	if err != nil {
+		t.Skipf("unable to get the modules of nginx: %v", err)
+	}
+	if !strings.Contains(string(out), "nginx-module-vts") && !strings.Contains(string(out), "vhost_traffic_status") {
+		t.Skip("nginx doesn't have the vhost traffic status module")
+	}
+	return binary
+}
+
+func getFromRealNginx(t *testing.T, addr, path, forwardedProto string) *http.Response {
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr+path, nil)
+	require.NoError(t, err)
+	req.Host = "realnginx.com"
+	req.Header.Set("X-Forwarded-Proto", forwardedProto)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp
+}
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
@@ -2,9 +2,11 @@ package nginx
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"os/exec"
 	"sort"
@@ -17,11 +19,19 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/sky-uk/feed/controller"
 	"github.com/sky-uk/feed/util"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
-	nginxStartDelay       = time.Millisecond * 100
-	metricsUpdateInterval = time.Second * 10
+	nginxStartDelay                 = time.Millisecond * 100
+	metricsUpdateInterval           = time.Second * 10
+	defaultCertificateCheckInterval = time.Second * 10
+
+	// reason of the events recorded on ingresses left out of the config
+	invalidConfigEventReason = "InvalidNginxConfig"
+	// reason of the events recorded on ingresses whose TLS profile isn't used by their host
+	tlsProfileConflictEventReason = "TLSProfileConflict"
 )
 
 // Port configuration
@@ -54,8 +64,14 @@ type Conf struct {
 	UpdatePeriod                 time.Duration
 	SSLPath                      string
 	VhostStatsSharedMemory       int
+	RateLimitSharedMemory        int
 	OpenTracingPlugin            string
 	OpenTracingConfig            string
+	// EventRecorder reports ingresses left out of the config because nginx rejected them. Optional.
+	EventRecorder record.EventRecorder
+	// TLSProfiles are the TLS settings servers can choose by name with IngressEntry.TLSProfile. Servers without a
+	// profile use DefaultTLSProfileName, which is DefaultTLSProfile unless overridden here.
+	TLSProfiles map[string]TLSProfile
 	HTTPConf
 }
 
@@ -108,6 +124,15 @@ type nginxUpdater struct {
 	doneCh                 chan struct{}
 	nginx                  *nginx
 	updateRequired         util.SafeBool
+	// excludedEntries nginx rejected, by key. They're left out of later configs until they change.
+	excludedEntries map[string]controller.IngressEntry
+	// tlsProfileConflicts are the profiles of the entries whose host uses another profile, by key, so events are
+	// only recorded when a conflict starts.
+	tlsProfileConflicts map[string]string
+	// rejectedConfigHash of the last config nginx rejected, so repeated rejections are only counted once
+	rejectedConfigHash string
+	// defaultCertificateHash of the SSLPath files when they were last read, to reload nginx when they change
+	defaultCertificateHash string
 }
 
 type nginxStarted struct {
@@ -120,6 +145,11 @@ type loadBalancerTemplate struct {
 	Conf
 	Servers   []*server
 	Upstreams []*upstream
+	// DefaultHTTPS configures the https port of the default server.
+	DefaultHTTPS   httpsConf
+	RateLimitZones []*rateLimitZone
+	RateLimitKeys  []*rateLimitKey
+	HSTSMaps       []*hstsMap
 }
 
 type server struct {
@@ -127,11 +157,28 @@ type server struct {
 	Names      []string
 	ServerName string
 	Locations  []*location
+	// TLSCertificate of the ServerName, if any of its entries has one.
+	TLSCertificate *controller.TLSCertificate
+	// TLSProfile chosen by the entries of the server, or empty for the default profile.
+	TLSProfile string
+	HTTPS      httpsConf
+	// HTTPSRedirectVariable holds the code of the https redirect of the request, or 0 if it isn't redirected,
+	// decided with HTTPSRedirects before nginx chooses the location. It's only set if a location is redirected.
+	HTTPSRedirectVariable string
+	HTTPSRedirects        []*httpsRedirect
+	HTTPSRedirectCodes    []int
+}
+
+// httpsConf configures the https port of a server.
+type httpsConf struct {
+	// SSLPath of the certificate files without their .crt and .key extensions.
+	SSLPath string
+	TLSProfile
 }
 
 type upstream struct {
 	ID             string
-	Server         string
+	Servers        []string
 	MaxConnections int
 }
 
@@ -144,12 +191,30 @@ type location struct {
 	BackendTimeoutSeconds int
 	ProxyBufferSize       int
 	ProxyBufferBlocks     int
+	// HTTPSRedirectCode redirects plain http requests to https if set.
+	HTTPSRedirectCode int
+	// HSTS is the Strict-Transport-Security header of https responses, if set. It's held by HSTSVariable.
+	HSTS         string
+	HSTSVariable string
+	RateLimit    *rateLimit
+	Attributes   map[string]interface{}
 }
 
 func (c *Conf) nginxConfFile() string {
 	return c.WorkingDir + "/nginx.conf"
 }
 
+// candidateConfFile is validated before being renamed to nginxConfFile, so nginx.conf always holds
+// the last known good config.
+func (c *Conf) candidateConfFile() string {
+	return c.nginxConfFile() + ".new"
+}
+
+// rejectedConfFile keeps the last config that failed validation, for debugging.
+func (c *Conf) rejectedConfFile() string {
+	return c.nginxConfFile() + ".rejected"
+}
+
 // New creates an nginx updater.
 func New(nginxConf Conf) controller.Updater {
 	initMetrics()
@@ -182,6 +247,8 @@ func (n *nginxUpdater) Start() error {
 		return fmt.Errorf("unable to initialise nginx config: %v", err)
 	}
 
+	n.checkDefaultCertificate()
+
 	return nil
 }
 
@@ -223,6 +290,7 @@ func (n *nginxUpdater) ensureNginxRunning() error {
 
 		go n.periodicallyUpdateMetrics()
 		go n.backgroundSignaller()
+		go n.periodicallyCheckDefaultCertificate()
 
 		n.nginxStarted.done = true
 	}
@@ -301,11 +369,14 @@ func (n *nginxUpdater) Update(entries controller.IngressEntries) error {
 		return errors.New("nginx update has been called with 0 entries")
 	}
 
+	n.reportTLSProfileConflicts(entries)
+
 	// Create new config
 	hasChanged, err := n.updateNginxConf(entries)
 	if err != nil {
 		return fmt.Errorf("unable to update nginx config: %v", err)
 	}
+	n.removeUnusedTLSCertificates(entries)
 
 	// This will start Nginx if it's the first call to Update
 	if nginxStartErr := n.ensureNginxRunning(); nginxStartErr != nil {
@@ -322,8 +393,17 @@ func (n *nginxUpdater) Update(entries controller.IngressEntries) error {
 	return nil
 }
 
+// UpdateDelta makes nginx a controller.DeltaUpdater, so the config isn't rendered again when no entries changed.
+// The config depends on every entry, so it's always rendered from all the entries.
+func (n *nginxUpdater) UpdateDelta(entries controller.IngressEntries, _ controller.IngressEntriesDelta) error {
+	return n.Update(entries)
+}
+
 func (n *nginxUpdater) updateNginxConf(entries controller.IngressEntries) (bool, error) {
-	updatedConfig, err := n.createConfig(entries)
+	// Entries nginx already rejected are left out first, so they don't cause a rejection and a search for the
+	// invalid entries on every update.
+	stillExcluded, candidates := n.splitExcludedEntries(entries)
+	updatedConfig, err := n.createConfig(candidates)
 	if err != nil {
 		return false, err
 	}
@@ -332,10 +412,131 @@ func (n *nginxUpdater) updateNginxConf(entries controller.IngressEntries) (bool,
 	if err != nil {
 		log.Debugf("Error trying to read nginx.conf: %v", err)
 		log.Info("Creating nginx.conf for the first time")
-		return writeFile(n.nginxConfFile(), updatedConfig)
+		return n.replaceConfig(updatedConfig)
+	}
+
+	hasChanged, err := n.diffAndUpdate(existingConfig, updatedConfig)
+	if _, invalid := err.(*invalidConfigError); !invalid {
+		if err == nil {
+			n.setExcludedEntries(stillExcluded)
+		}
+		return hasChanged, err
+	}
+
+	// Find the entries nginx rejects, so the rest can still be applied.
+	if valid, validationErr := n.entriesAreValid(nil); validationErr != nil || !valid {
+		log.Warn("Nginx rejects the config without any ingress entries, so it can't exclude invalid entries")
+		return false, err
+	}
+	invalidEntries, bisectErr := n.findInvalidEntries(candidates)
+	if bisectErr != nil {
+		log.Warnf("Unable to find the ingress entries that nginx rejects: %v", bisectErr)
+		return false, err
+	}
+	if len(invalidEntries) == 0 || len(invalidEntries) == len(candidates) {
+		log.Warn("Nginx rejects the config, but not because of a subset of ingress entries")
+		return false, err
+	}
+
+	validConfig, err := n.createConfig(withoutEntries(candidates, invalidEntries))
+	if err != nil {
+		return false, err
+	}
+	hasChanged, err = n.diffAndUpdate(existingConfig, validConfig)
+	if err != nil {
+		return false, err
+	}
+
+	n.setExcludedEntries(append(stillExcluded, invalidEntries...))
+	return hasChanged, nil
+}
+
+// splitExcludedEntries returns the entries which are unchanged since nginx rejected them, and the rest.
+func (n *nginxUpdater) splitExcludedEntries(entries controller.IngressEntries) (controller.IngressEntries,
+	controller.IngressEntries) {
+	var excluded, remaining controller.IngressEntries
+	for _, entry := range entries {
+		if rejected, ok := n.excludedEntries[entry.String()]; ok && controller.SameEntry(rejected, entry) {
+			excluded = append(excluded, entry)
+		} else {
+			remaining = append(remaining, entry)
+		}
+	}
+	return excluded, remaining
+}
+
+// findInvalidEntries bisects entries to find those which nginx rejects.
+func (n *nginxUpdater) findInvalidEntries(entries controller.IngressEntries) (controller.IngressEntries, error) {
+	valid, err := n.entriesAreValid(entries)
+	if err != nil || valid {
+		return nil, err
+	}
+	if len(entries) == 1 {
+		return entries, nil
+	}
+
+	middle := len(entries) / 2
+	firstHalf, err := n.findInvalidEntries(entries[:middle])
+	if err != nil {
+		return nil, err
+	}
+	secondHalf, err := n.findInvalidEntries(entries[middle:])
+	if err != nil {
+		return nil, err
+	}
+	return append(firstHalf, secondHalf...), nil
+}
+
+func (n *nginxUpdater) entriesAreValid(entries controller.IngressEntries) (bool, error) {
+	config, err := n.createConfig(entries)
+	if err != nil {
+		return false, err
+	}
+	if _, err := writeFile(n.candidateConfFile(), config); err != nil {
+		return false, err
+	}
+	defer os.Remove(n.candidateConfFile())
+
+	err = n.checkNginxConfig(n.candidateConfFile())
+	if _, invalid := err.(*invalidConfigError); invalid {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func withoutEntries(entries, excluded controller.IngressEntries) controller.IngressEntries {
+	excludedKeys := make(map[string]bool)
+	for _, entry := range excluded {
+		excludedKeys[entry.String()] = true
+	}
+
+	var remaining controller.IngressEntries
+	for _, entry := range entries {
+		if !excludedKeys[entry.String()] {
+			remaining = append(remaining, entry)
+		}
+	}
+	return remaining
+}
+
+// setExcludedEntries reports the entries left out of the applied config. Events are only recorded
+// for entries which weren't already excluded by the previous update.
+func (n *nginxUpdater) setExcludedEntries(excluded controller.IngressEntries) {
+	excludedByKey := make(map[string]controller.IngressEntry)
+	for _, entry := range excluded {
+		key := entry.String()
+		excludedByKey[key] = entry
+		log.Warnf("Excluded %s from the nginx config, as nginx rejects it", entry)
+
+		if _, alreadyExcluded := n.excludedEntries[key]; alreadyExcluded || n.EventRecorder == nil || entry.Ingress == nil {
+			continue
+		}
+		n.EventRecorder.Eventf(entry.Ingress, v1.EventTypeWarning, invalidConfigEventReason,
+			"Path %s%s was left out of the nginx config, as nginx rejects it", entry.Host, entry.Path)
 	}
 
-	return n.diffAndUpdate(existingConfig, updatedConfig)
+	n.excludedEntries = excludedByKey
+	setExcludedEntriesMetric(len(excludedByKey))
 }
 
 func (n *nginxUpdater) diffAndUpdate(existing, updated []byte) (bool, error) {
@@ -347,33 +548,83 @@ func (n *nginxUpdater) diffAndUpdate(existing, updated []byte) (bool, error) {
 
 	if len(diffOutput) == 0 {
 		log.Info("Configuration has not changed")
+		n.setConfigRejected(nil, nil)
 		return false, nil
 	}
 
 	log.Infof("Updating nginx config: %s", string(diffOutput))
-	_, err = writeFile(n.nginxConfFile(), updated)
-
-	if err != nil {
+	if _, err := writeFile(n.candidateConfFile(), updated); err != nil {
 		log.Errorf("Unable to write nginx configuration: %v", err)
 		return false, err
 	}
 
-	err = n.checkNginxConfig()
-	if err != nil {
+	if err := n.checkNginxConfig(n.candidateConfFile()); err != nil {
+		if renameErr := os.Rename(n.candidateConfFile(), n.rejectedConfFile()); renameErr != nil {
+			log.Warnf("Unable to keep rejected nginx configuration: %v", renameErr)
+		}
+		n.setConfigRejected(updated, err)
 		return false, err
 	}
 
+	if err := os.Rename(n.candidateConfFile(), n.nginxConfFile()); err != nil {
+		log.Errorf("Unable to replace nginx configuration: %v", err)
+		return false, err
+	}
+
+	n.setConfigRejected(nil, nil)
+	return true, nil
+}
+
+// replaceConfig atomically replaces nginx.conf without validating it.
+func (n *nginxUpdater) replaceConfig(config []byte) (bool, error) {
+	if _, err := writeFile(n.candidateConfFile(), config); err != nil {
+		return false, err
+	}
+	if err := os.Rename(n.candidateConfFile(), n.nginxConfFile()); err != nil {
+		return false, err
+	}
 	return true, nil
 }
 
-func (n *nginxUpdater) checkNginxConfig() error {
-	cmd := exec.Command(n.BinaryLocation, "-t", "-c", n.nginxConfFile())
+// setConfigRejected reports whether nginx rejected the config. A config is only counted as a rejection the first
+// time, as the same entries are usually retried until they change.
+func (n *nginxUpdater) setConfigRejected(config []byte, err error) {
+	if err == nil {
+		n.rejectedConfigHash = ""
+		setConfigRejectedMetric(false)
+		return
+	}
+
+	setConfigRejectedMetric(true)
+	hash := fmt.Sprintf("%x", sha256.Sum256(config))
+	if hash == n.rejectedConfigHash {
+		log.Debug("Nginx rejected the same configuration again, keeping the last valid configuration")
+		return
+	}
+	n.rejectedConfigHash = hash
+	log.Errorf("Rejected nginx configuration, keeping the last valid configuration. "+
+		"The rejected configuration is at %s", n.rejectedConfFile())
+	incrementConfigRejectionsMetric()
+}
+
+// invalidConfigError is returned when nginx rejects a config.
+type invalidConfigError struct {
+	err    error
+	output string
+}
+
+func (e *invalidConfigError) Error() string {
+	return fmt.Sprintf("invalid config: %v: %s", e.err, e.output)
+}
+
+func (n *nginxUpdater) checkNginxConfig(configFile string) error {
+	cmd := exec.Command(n.BinaryLocation, "-t", "-c", configFile)
 	var out bytes.Buffer
 	cmd.Stderr = &out
 	cmd.Stdout = &out
 	err := cmd.Run()
 	if err != nil {
-		return fmt.Errorf("invalid config: %v: %s", err, out.String())
+		return &invalidConfigError{err: err, output: out.String()}
 	}
 	return nil
 }
@@ -386,13 +637,24 @@ func (n *nginxUpdater) createConfig(entries controller.IngressEntries) ([]byte,
 
 	serverEntries := createServerEntries(entries)
 	upstreamEntries := createUpstreamEntries(entries)
+	if err := n.writeTLSCertificates(serverEntries); err != nil {
+		return nil, err
+	}
+	for _, s := range serverEntries {
+		s.HTTPS.TLSProfile = n.tlsProfile(s.TLSProfile)
+	}
+	setHTTPSRedirects(serverEntries)
 
 	n.AccessLogHeaders = n.getNginxLogHeaders()
 	var output bytes.Buffer
 	lbTemplate := loadBalancerTemplate{
-		Conf:      n.Conf,
-		Servers:   serverEntries,
-		Upstreams: upstreamEntries,
+		Conf:           n.Conf,
+		Servers:        serverEntries,
+		Upstreams:      upstreamEntries,
+		DefaultHTTPS:   httpsConf{SSLPath: n.SSLPath, TLSProfile: n.defaultServerTLSProfile()},
+		RateLimitZones: rateLimitZones(entries),
+		RateLimitKeys:  rateLimitKeys(entries),
+		HSTSMaps:       setHSTSVariables(serverEntries),
 	}
 	err = tmpl.Execute(&output, lbTemplate)
 
@@ -424,7 +686,7 @@ func createUpstreamEntries(entries controller.IngressEntries) []*upstream {
 	for _, ingressEntry := range entries {
 		upstream := &upstream{
 			ID:             upstreamID(ingressEntry),
-			Server:         fmt.Sprintf("%s:%d", ingressEntry.ServiceAddress, ingressEntry.ServicePort),
+			Servers:        upstreamServers(ingressEntry),
 			MaxConnections: ingressEntry.BackendMaxConnections,
 		}
 		idToUpstream[upstream.ID] = upstream
@@ -439,7 +701,49 @@ func createUpstreamEntries(entries controller.IngressEntries) []*upstream {
 	return sortedUpstreams
 }
 
+func upstreamServers(e controller.IngressEntry) []string {
+	if !e.RouteToEndpoints {
+		return []string{fmt.Sprintf("%s:%d", e.ServiceAddress, e.ServicePort)}
+	}
+
+	var servers []string
+	for _, endpoint := range e.Endpoints {
+		servers = append(servers, fmt.Sprintf("%s:%d", endpoint.Address, endpoint.Port))
+	}
+	return servers
+}
+
+// httpsRedirectCode defaults to 308, so the method and body of redirected requests are kept.
+func httpsRedirectCode(e controller.IngressEntry) int {
+	if !e.HTTPSRedirect {
+		return 0
+	}
+	if e.HTTPSRedirectCode == 0 {
+		return http.StatusPermanentRedirect
+	}
+	return e.HTTPSRedirectCode
+}
+
+func hstsHeader(e controller.IngressEntry) string {
+	if !e.HSTS {
+		return ""
+	}
+	header := fmt.Sprintf("max-age=%d", e.HSTSMaxAgeSeconds)
+	if e.HSTSIncludeSubDomains {
+		header += "; includeSubDomains"
+	}
+	if e.HSTSPreload {
+		header += "; preload"
+	}
+	return header
+}
+
 func upstreamID(e controller.IngressEntry) string {
+	// Endpoint upstreams are keyed by service name, as headless services don't have an address.
+	// Service names can't contain dots, so these never collide with address based IDs.
+	if e.RouteToEndpoints {
+		return fmt.Sprintf("%s.%s.%d", e.Namespace, e.ServiceName, e.ServicePort)
+	}
 	return fmt.Sprintf("%s.%s.%d", e.Namespace, e.ServiceAddress, e.ServicePort)
 }
 
@@ -474,10 +778,16 @@ func createServerEntries(entries controller.IngressEntries) []*server {
 			BackendTimeoutSeconds: ingressEntry.BackendTimeoutSeconds,
 			ProxyBufferSize:       ingressEntry.ProxyBufferSize,
 			ProxyBufferBlocks:     ingressEntry.ProxyBufferBlocks,
+			HTTPSRedirectCode:     httpsRedirectCode(ingressEntry),
+			HSTS:                  hstsHeader(ingressEntry),
+			RateLimit:             locationRateLimit(ingressEntry),
+			Attributes:            ingressEntry.Attributes,
 		}
 
 		serverEntry.Names = append(serverEntry.Names, ingressEntry.NamespaceName())
 		serverEntry.Locations = append(serverEntry.Locations, &location)
+		serverEntry.TLSCertificate = preferredTLSCertificate(serverEntry.TLSCertificate, ingressEntry.TLSCertificate)
+		serverEntry.TLSProfile = preferredTLSProfile(serverEntry.TLSProfile, ingressEntry.TLSProfile)
 	}
 
 	var serverEntries []*server
@@ -492,6 +802,21 @@ func createServerEntries(entries controller.IngressEntries) []*server {
 	return serverEntries
 }
 
+// preferredTLSCertificate chooses between the certificates of the entries of a server consistently, whatever their
+// order, if ingresses for the same host list it under different Secrets.
+func preferredTLSCertificate(a, b *controller.TLSCertificate) *controller.TLSCertificate {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if b.SecretNamespace+"/"+b.SecretName < a.SecretNamespace+"/"+a.SecretName {
+		return b
+	}
+	return a
+}
+
 type ingressKey struct {
 	Host, Path string
 }
@@ -19,11 +19,15 @@ var once sync.Once
 var connections, waitingConnections, writingConnections, readingConnections prometheus.Gauge
 var totalAccepts, totalHandled, totalRequests prometheus.Gauge
 var ingressRequests, endpointRequests, ingressBytes, endpointBytes *prometheus.GaugeVec
-var reloads prometheus.Counter
+var rateLimitedRequests *prometheus.GaugeVec
+var reloads, configRejections prometheus.Counter
+var configRejected, excludedEntries prometheus.Gauge
+var defaultCertificateExpiry prometheus.Gauge
 var ingressRequestsLabelNames = []string{"host", "path", "code"}
 var endpointRequestsLabelNames = []string{"name", "endpoint", "code"}
 var ingressBytesLabelNames = []string{"host", "path", "direction"}
 var endpointBytesLabelNames = []string{"name", "endpoint", "direction"}
+var rateLimitedRequestsLabelNames = []string{"host", "path"}
 
 func initMetrics() {
 	once.Do(func() {
@@ -64,8 +68,22 @@ func initMetrics() {
 				"Direction is 'in' for bytes received from the endpoint, 'out' for bytes sent to the endpoint. "+
 				"For implementation reasons, this counter is a gauge.",
 			endpointBytesLabelNames)
+		rateLimitedRequests = metrics.RegisterNewDefaultGaugeVec(metrics.PrometheusIngressSubsystem,
+			"ingress_rate_limited_requests",
+			"The number of requests rejected by the rate limit of an ingress. These aren't counted by ingress_requests. "+
+				"For implementation reasons, this counter is a gauge.",
+			rateLimitedRequestsLabelNames)
 		reloads = metrics.RegisterNewDefaultCounter(metrics.PrometheusIngressSubsystem, "reloads",
 			"Count of Nginx configuration reloads")
+		configRejections = metrics.RegisterNewDefaultCounter(metrics.PrometheusIngressSubsystem, "nginx_config_rejections",
+			"Count of Nginx configurations which failed validation and were not applied.")
+		configRejected = metrics.RegisterNewDefaultGauge(metrics.PrometheusIngressSubsystem, "nginx_config_rejected",
+			"1 if the latest Nginx configuration failed validation, so the last valid configuration is still in use. 0 otherwise.")
+		excludedEntries = metrics.RegisterNewDefaultGauge(metrics.PrometheusIngressSubsystem, "nginx_config_excluded_entries",
+			"The number of ingress entries left out of the Nginx configuration because they failed validation.")
+		defaultCertificateExpiry = metrics.RegisterNewDefaultGauge(metrics.PrometheusIngressSubsystem,
+			"default_certificate_expiry_timestamp_seconds",
+			"The time the default certificate at --ssl-path expires, in seconds since the epoch.")
 	})
 }
 
@@ -82,10 +100,11 @@ type VTSConnections struct {
 
 // VTSRequestData contains request details.
 type VTSRequestData struct {
-	Server    string        `json:"server"`
-	InBytes   float64       `json:"inBytes"`
-	OutBytes  float64       `json:"outBytes"`
-	Responses *VTSResponses `json:"responses"`
+	Server         string        `json:"server"`
+	RequestCounter float64       `json:"requestCounter"`
+	InBytes        float64       `json:"inBytes"`
+	OutBytes       float64       `json:"outBytes"`
+	Responses      *VTSResponses `json:"responses"`
 }
 
 // VTSResponses contains response details.
@@ -117,6 +136,7 @@ func parseAndSetNginxMetrics(statusPort int) error {
 
 	updateNginxMetrics(vtsMetrics)
 	updateIngressMetrics(vtsMetrics)
+	updateRateLimitMetrics(vtsMetrics)
 	updateEndpointMetrics(vtsMetrics)
 
 	return nil
@@ -134,6 +154,9 @@ func updateNginxMetrics(metrics VTSMetrics) {
 
 func updateIngressMetrics(metrics VTSMetrics) {
 	for host, zoneDetails := range metrics.FilterZones {
+		if strings.HasPrefix(host, rateLimitedFilterGroup) {
+			continue
+		}
 		for zone, requestData := range zoneDetails {
 			responses := requestData.Responses
 			if responses == nil {
@@ -159,6 +182,19 @@ func updateIngressMetrics(metrics VTSMetrics) {
 	}
 }
 
+func updateRateLimitMetrics(metrics VTSMetrics) {
+	for group, zoneDetails := range metrics.FilterZones {
+		if !strings.HasPrefix(group, rateLimitedFilterGroup) {
+			continue
+		}
+		host := strings.TrimPrefix(group, rateLimitedFilterGroup)
+		for zone, requestData := range zoneDetails {
+			path := strings.TrimSuffix(zone, "::rate_limited")
+			rateLimitedRequests.WithLabelValues(host, path).Set(requestData.RequestCounter)
+		}
+	}
+}
+
 func updateEndpointMetrics(metrics VTSMetrics) {
 	for name, zones := range metrics.UpstreamZones {
 		for _, zone := range zones {
@@ -191,3 +227,19 @@ func parseStatusBody(body io.Reader) (VTSMetrics, error) {
 func incrementReloadMetric() {
 	reloads.Inc()
 }
+
+func incrementConfigRejectionsMetric() {
+	configRejections.Inc()
+}
+
+func setExcludedEntriesMetric(count int) {
+	excludedEntries.Set(float64(count))
+}
+
+func setConfigRejectedMetric(rejected bool) {
+	if rejected {
+		configRejected.Set(1)
+	} else {
+		configRejected.Set(0)
+	}
+}
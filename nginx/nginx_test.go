@@ -21,6 +21,9 @@ import (
 	"github.com/sky-uk/feed/controller"
 	"github.com/sky-uk/feed/util/metrics"
 	"github.com/stretchr/testify/assert"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 )
 
 func init() {
@@ -65,6 +68,13 @@ func newNginxWithConf(conf Conf) controller.Updater {
 	return lb
 }
 
+func TestIsDeltaUpdater(t *testing.T) {
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	assert.Implements(t, (*controller.DeltaUpdater)(nil), newUpdater(tmpDir))
+}
+
 func TestCanStartThenStop(t *testing.T) {
 	tmpDir := setupWorkDir(t)
 	defer os.Remove(tmpDir)
@@ -1211,6 +1221,39 @@ func TestNginxIngressEntries(t *testing.T) {
 					"        }\n",
 			},
 		},
+		{
+			"Check endpoint entries create an upstream server per endpoint",
+			defaultConf,
+			[]controller.IngressEntry{
+				{
+					Host:             "endpoints.com",
+					Namespace:        "core",
+					Name:             "endpoints-ingress",
+					Path:             "/endpoints-path",
+					ServiceAddress:   "None",
+					ServiceName:      "headless",
+					ServicePort:      8080,
+					RouteToEndpoints: true,
+					Endpoints: []controller.Endpoint{
+						{Address: "10.2.0.1", Port: 8080},
+						{Address: "10.2.0.2", Port: 8080},
+					},
+					BackendMaxConnections: 100,
+				},
+			},
+			[]string{
+				"    upstream core.headless.8080 {\n" +
+					"        server 10.2.0.1:8080 max_conns=100;\n" +
+					"        server 10.2.0.2:8080 max_conns=100;\n" +
+					"        keepalive 1024;\n" +
+					"    }",
+			},
+			[]string{
+				"        location /endpoints-path/ {\n" +
+					"            # Keep original path when proxying.\n" +
+					"            proxy_pass http://core.headless.8080;\n",
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -1473,6 +1516,39 @@ func metricName(c prometheus.Collector) string {
 	return fqNameField.String()
 }
 
+func TestNginxTemplateCanReadEntryAttributes(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	ts := stubHealthPort()
+	defer ts.Close()
+	conf := newConf(tmpDir, fakeNginx)
+	conf.HealthPort = getPort(ts)
+	lb := newNginxWithConf(conf)
+
+	template := `{{ range $server := .Servers }}{{ range $location := $server.Locations }}` +
+		`# team: {{ index $location.Attributes "example.com/team" }}{{ end }}{{ end }}`
+	assert.NoError(ioutil.WriteFile(tmpDir+"/nginx.tmpl", []byte(template), 0644))
+
+	entry := controller.IngressEntry{
+		Host:           "chris.com",
+		Path:           "/path",
+		ServiceAddress: "service",
+		ServicePort:    9090,
+	}
+	entry.SetAttribute("example.com/team", "ingress")
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update([]controller.IngressEntry{entry}))
+
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.Equal("# team: ingress", string(config))
+
+	assert.NoError(lb.Stop())
+}
+
 func TestFailsToUpdateIfConfigurationIsBroken(t *testing.T) {
 	assert := assert.New(t)
 	tmpDir := setupWorkDir(t)
@@ -1495,6 +1571,140 @@ func TestFailsToUpdateIfConfigurationIsBroken(t *testing.T) {
 	assert.Contains(err.Error(), "./fake_nginx_failing_reload.sh -t")
 }
 
+func TestKeepsLastValidConfigurationIfUpdatedConfigurationIsRejected(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	ts := stubHealthPort()
+	defer ts.Close()
+	conf := newConf(tmpDir, "./fake_nginx_rejecting_config.sh")
+	conf.HealthPort = getPort(ts)
+	lb := newNginxWithConf(conf)
+
+	validEntries := []controller.IngressEntry{{
+		Host:           "chris.com",
+		Path:           "/path",
+		ServiceAddress: "service",
+		ServicePort:    9090,
+	}}
+	rejectedEntries := []controller.IngressEntry{{
+		Host:           "reject.me",
+		Path:           "/path",
+		ServiceAddress: "service",
+		ServicePort:    9090,
+	}}
+	rejectionsBefore := testutil.ToFloat64(configRejections)
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(validEntries))
+	validConfig, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+
+	err = lb.Update(rejectedEntries)
+	assert.Error(err)
+	assert.Contains(err.Error(), "Config check failed")
+
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.Equal(string(validConfig), string(config), "should keep the last valid config")
+	rejectedConfig, err := ioutil.ReadFile(tmpDir + "/nginx.conf.rejected")
+	assert.NoError(err)
+	assert.Contains(string(rejectedConfig), "reject.me")
+	assert.NoError(lb.Health(), "rejected configs are reported by Update, as restarting nginx won't fix them")
+	assert.Equal(rejectionsBefore+1, testutil.ToFloat64(configRejections))
+	assert.Equal(float64(1), testutil.ToFloat64(configRejected))
+
+	assert.Error(lb.Update(rejectedEntries))
+	assert.Equal(rejectionsBefore+1, testutil.ToFloat64(configRejections), "the same config is only counted once")
+
+	assert.NoError(lb.Update(validEntries))
+	assert.NoError(lb.Health())
+	assert.Equal(float64(0), testutil.ToFloat64(configRejected))
+
+	assert.NoError(lb.Stop())
+}
+
+func TestExcludesIngressEntriesWhichNginxRejects(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	ts := stubHealthPort()
+	defer ts.Close()
+	recorder := record.NewFakeRecorder(10)
+	conf := newConf(tmpDir, "./fake_nginx_rejecting_config.sh")
+	conf.HealthPort = getPort(ts)
+	conf.EventRecorder = recorder
+	lb := newNginxWithConf(conf)
+
+	validEntries := []controller.IngressEntry{}
+	for _, host := range []string{"a.com", "b.com", "c.com"} {
+		validEntries = append(validEntries, controller.IngressEntry{
+			Host:           host,
+			Path:           "/path",
+			ServiceAddress: "service",
+			ServicePort:    9090,
+		})
+	}
+	rejectedEntry := controller.IngressEntry{
+		Namespace:      "core",
+		Name:           "rejected-ingress",
+		Host:           "reject.me",
+		Path:           "/path",
+		ServiceAddress: "service",
+		ServicePort:    9090,
+		Ingress:        &networkingv1.Ingress{},
+	}
+	entries := append([]controller.IngressEntry{rejectedEntry}, validEntries...)
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	for _, entry := range validEntries {
+		assert.Contains(string(config), entry.Host)
+	}
+	assert.NotContains(string(config), "reject.me")
+	assert.NoError(lb.Health())
+	assert.Equal(float64(1), testutil.ToFloat64(excludedEntries))
+	assert.Equal("Warning InvalidNginxConfig Path reject.me/path was left out of the nginx config, as nginx rejects it",
+		<-recorder.Events)
+
+	rejectionsBefore := testutil.ToFloat64(configRejections)
+	assert.NoError(os.Remove(tmpDir + "/nginx.conf.rejected"))
+
+	// the event is only recorded when the entry is first excluded, and unchanged entries aren't tested again
+	assert.NoError(lb.Update(entries))
+	assert.Empty(recorder.Events)
+	assert.Equal(rejectionsBefore, testutil.ToFloat64(configRejections))
+	assert.NoFileExists(tmpDir+"/nginx.conf.rejected", "the config with the excluded entry shouldn't be tried again")
+	assert.Equal(float64(1), testutil.ToFloat64(excludedEntries))
+
+	// nor are unchanged entries of an ingress which was written to, such as by a status update
+	rewrittenEntry := rejectedEntry
+	rewrittenEntry.Ingress = &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{ResourceVersion: "2"}}
+	assert.NoError(lb.Update(append([]controller.IngressEntry{rewrittenEntry}, validEntries...)))
+	assert.Empty(recorder.Events)
+	assert.Equal(rejectionsBefore, testutil.ToFloat64(configRejections))
+	assert.NoFileExists(tmpDir + "/nginx.conf.rejected")
+	assert.Equal(float64(1), testutil.ToFloat64(excludedEntries))
+
+	// a changed entry is tested again
+	changedEntry := rejectedEntry
+	changedEntry.ProxyBufferSize = 16
+	assert.NoError(lb.Update(append([]controller.IngressEntry{changedEntry}, validEntries...)))
+	assert.FileExists(tmpDir + "/nginx.conf.rejected")
+	assert.Equal(rejectionsBefore+1, testutil.ToFloat64(configRejections))
+	assert.Equal(float64(1), testutil.ToFloat64(excludedEntries))
+
+	assert.NoError(lb.Update(validEntries))
+	assert.Equal(float64(0), testutil.ToFloat64(excludedEntries))
+
+	assert.NoError(lb.Stop())
+}
+
 func setupWorkDir(t *testing.T) string {
 	tmpDir, err := ioutil.TempDir(os.TempDir(), "ingress_lb_test")
 	assert.NoError(t, err)
@@ -1720,6 +1930,20 @@ var statusResponseBody = []byte(`{
           "scarce": 0
         }
       }
+    },
+    "rate_limited::heapster.sandbox.cosmic.sky": {
+      "/::rate_limited": {
+        "requestCounter": 5,
+        "inBytes": 500,
+        "outBytes": 1000,
+        "responses": {
+          "1xx": 0,
+          "2xx": 0,
+          "3xx": 0,
+          "4xx": 5,
+          "5xx": 0
+        }
+      }
     }
   },
   "upstreamZones": {
@@ -1758,3 +1982,57 @@ var statusResponseBody = []byte(`{
   }
 }
 `)
+
+func TestHTTPSRedirectAndHSTS(t *testing.T) {
+	tmpDir := setupWorkDir(t)
+	defer os.RemoveAll(tmpDir)
+	conf := newConf(tmpDir, fakeNginx)
+	conf.Ports = []Port{{Name: "http", Port: 80}, {Name: "https", Port: 443}}
+	n := New(conf).(*nginxUpdater)
+
+	redirected := controller.IngressEntry{
+		Host:                  "redirect.com",
+		Path:                  "/",
+		ServiceAddress:        "service",
+		ServicePort:           9090,
+		HTTPSRedirect:         true,
+		HSTS:                  true,
+		HSTSMaxAgeSeconds:     31536000,
+		HSTSIncludeSubDomains: true,
+		HSTSPreload:           true,
+	}
+	movedPermanently := redirected
+	movedPermanently.Host = "moved.com"
+	movedPermanently.HTTPSRedirectCode = 301
+	movedPermanently.HSTS = false
+	plain := controller.IngressEntry{Host: "plain.com", Path: "/", ServiceAddress: "service", ServicePort: 9090}
+
+	config, err := n.createConfig(controller.IngressEntries{redirected, movedPermanently, plain})
+	assert.NoError(t, err)
+
+	assertConfigEntries(t, "redirects", "redirect", `(?s)(listen 80;\n\s+server_name \S+;\n\n\s+# Redirect.+?client_max)`,
+		[]string{
+			"listen 80;\n        server_name moved.com;\n\n" +
+				"        # Redirect to https, unless a trusted frontend has already terminated it.\n" +
+				"        if ($https_redirect_0 = 301) {\n" +
+				"            return 301 https://$host$request_uri;\n" +
+				"        }\n\n",
+			"listen 80;\n        server_name redirect.com;\n\n" +
+				"        # Redirect to https, unless a trusted frontend has already terminated it.\n" +
+				"        if ($https_redirect_2 = 308) {\n" +
+				"            return 308 https://$host$request_uri;\n" +
+				"        }\n\n",
+		}, string(config))
+	assert.Contains(t, string(config), "    map \"$trusted_frontend_scheme:$uri\" $https_redirect_0 {\n"+
+		"        default 0;\n"+
+		"        \"~^https:\" 0;\n"+
+		"        \"~^[^:]*:/\" 301;\n"+
+		"    }\n")
+	assert.Contains(t, string(config), "    map $trusted_frontend_scheme $hsts_0 {\n"+
+		"        https \"max-age=31536000; includeSubDomains; preload\";\n"+
+		"        default \"\";\n"+
+		"    }\n")
+	assert.Equal(t, 2, strings.Count(string(config), "add_header Strict-Transport-Security $hsts_0 always;"),
+		"HSTS should be sent on both ports once https has been used")
+	assert.NotRegexp(t, `(?s)location [^{]+\{[^}]*\bif\b`, string(config), "if in a location breaks stripped paths")
+}
@@ -0,0 +1,104 @@
+package nginx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sky-uk/feed/controller"
+)
+
+// rateLimitedFilterGroup prefixes the server name of the vhost stats filter counting the requests rejected by
+// rate limits, so they aren't mistaken for ingress requests.
+const rateLimitedFilterGroup = "rate_limited::"
+
+// rateLimitZone holds the request rates of the clients of an ingress.
+type rateLimitZone struct {
+	Name string
+	// Key is the nginx variable identifying clients.
+	Key  string
+	Rate string
+}
+
+// rateLimitKey identifies clients by a request header, or by their IP if they don't send it.
+type rateLimitKey struct {
+	// Variable is set to the value of Header, or to the binary IP of the client if Header is empty.
+	Variable string
+	Header   string
+}
+
+// rateLimit applies the zone of its ingress to a location.
+type rateLimit struct {
+	Zone  string
+	Burst int
+}
+
+// rateLimitZoneOf returns the zone of the entry's ingress, or nil if it isn't rate limited. The zone is named after
+// its key as well as its ingress, as nginx refuses to reload if the key of an existing zone changes.
+func rateLimitZoneOf(e controller.IngressEntry) *rateLimitZone {
+	if e.RateLimit == "" {
+		return nil
+	}
+	if e.RateLimitHeader == "" {
+		return &rateLimitZone{
+			Name: fmt.Sprintf("%s.%s.ip", e.Namespace, e.Name),
+			Key:  "$binary_remote_addr",
+			Rate: e.RateLimit,
+		}
+	}
+	header := strings.ToLower(e.RateLimitHeader)
+	return &rateLimitZone{
+		Name: fmt.Sprintf("%s.%s.header.%s", e.Namespace, e.Name, header),
+		Key:  headerRateLimitKey(header).Variable,
+		Rate: e.RateLimit,
+	}
+}
+
+func headerRateLimitKey(header string) *rateLimitKey {
+	variable := strings.Replace(header, "-", "_", -1)
+	return &rateLimitKey{Variable: "$rate_limit_key_" + variable, Header: "$http_" + variable}
+}
+
+func locationRateLimit(e controller.IngressEntry) *rateLimit {
+	zone := rateLimitZoneOf(e)
+	if zone == nil {
+		return nil
+	}
+	return &rateLimit{Zone: zone.Name, Burst: e.RateLimitBurst}
+}
+
+// rateLimitZones returns the zones of the entries sorted by name. All entries of an ingress share its annotations,
+// so they have the same rate.
+func rateLimitZones(entries controller.IngressEntries) []*rateLimitZone {
+	zonesByName := make(map[string]*rateLimitZone)
+	for _, e := range entries {
+		if zone := rateLimitZoneOf(e); zone != nil {
+			zonesByName[zone.Name] = zone
+		}
+	}
+
+	zones := make([]*rateLimitZone, 0, len(zonesByName))
+	for _, zone := range zonesByName {
+		zones = append(zones, zone)
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].Name < zones[j].Name })
+	return zones
+}
+
+// rateLimitKeys returns the keys of the entries limited by a request header, sorted by header.
+func rateLimitKeys(entries controller.IngressEntries) []*rateLimitKey {
+	keysByHeader := make(map[string]*rateLimitKey)
+	for _, e := range entries {
+		if e.RateLimit != "" && e.RateLimitHeader != "" {
+			key := headerRateLimitKey(strings.ToLower(e.RateLimitHeader))
+			keysByHeader[key.Header] = key
+		}
+	}
+
+	keys := make([]*rateLimitKey, 0, len(keysByHeader))
+	for _, key := range keysByHeader {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Header < keys[j].Header })
+	return keys
+}
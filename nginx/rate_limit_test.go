@@ -0,0 +1,113 @@
+package nginx
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sky-uk/feed/controller"
+	"github.com/stretchr/testify/assert"
+)
+
+func rateLimitedEntry(name, path string) controller.IngressEntry {
+	return controller.IngressEntry{
+		Host:           "limited.com",
+		Namespace:      "core",
+		Name:           name,
+		Path:           path,
+		ServiceAddress: "service",
+		ServicePort:    9090,
+		RateLimit:      "10r/s",
+	}
+}
+
+func TestRateLimitedIngressesHaveAZoneEach(t *testing.T) {
+	tmpDir := setupWorkDir(t)
+	defer os.RemoveAll(tmpDir)
+	conf := newConf(tmpDir, fakeNginx)
+	conf.RateLimitSharedMemory = 2
+	n := New(conf).(*nginxUpdater)
+
+	byIP := rateLimitedEntry("by-ip", "/ip")
+	byIP.RateLimitBurst = 20
+	byIPOtherPath := rateLimitedEntry("by-ip", "/other")
+	byHeader := rateLimitedEntry("by-header", "/header")
+	byHeader.RateLimit = "600r/m"
+	byHeader.RateLimitHeader = "X-Api-Key"
+	unlimited := rateLimitedEntry("unlimited", "/unlimited")
+	unlimited.RateLimit = ""
+
+	config, err := n.createConfig(controller.IngressEntries{byIP, byIPOtherPath, byHeader, unlimited})
+	assert.NoError(t, err)
+
+	assertConfigEntries(t, "zones", "limit_req_zone", `(?m)^\s*(limit_req_zone .+)$`, []string{
+		"limit_req_zone $rate_limit_key_x_api_key zone=core.by-header.header.x-api-key:2m rate=600r/m;",
+		"limit_req_zone $binary_remote_addr zone=core.by-ip.ip:2m rate=10r/s;",
+	}, string(config))
+	assertConfigEntries(t, "limits", "limit_req", `(?m)^\s*(limit_req zone.+)$`, []string{
+		"limit_req zone=core.by-header.header.x-api-key;",
+		"limit_req zone=core.by-ip.ip burst=20 nodelay;",
+		"limit_req zone=core.by-ip.ip;",
+	}, string(config))
+	assert.Contains(t, string(config), "    map $http_x_api_key $rate_limit_key_x_api_key {\n"+
+		"        \"\" $binary_remote_addr;\n"+
+		"        default $http_x_api_key;\n"+
+		"    }\n", "clients without the header should be limited by IP")
+	assert.Equal(t, 3, strings.Count(string(config), "limit_req_status 429;"))
+	assert.Contains(t, string(config), "error_page 429 @rate_limited_0;\n")
+	assert.Contains(t, string(config), "        location @rate_limited_0 {\n"+
+		"            vhost_traffic_status_filter_by_set_key /header/::rate_limited rate_limited::$server_name;\n"+
+		"            return 429;\n"+
+		"        }")
+	assert.NotContains(t, string(config), "@rate_limited_3", "the unlimited location shouldn't have a named location")
+}
+
+func TestRateLimitedRequestsAreCountedSeparately(t *testing.T) {
+	initMetrics()
+	vtsMetrics, err := parseStatusBody(bytes.NewReader(statusResponseBody))
+	assert.NoError(t, err)
+
+	updateIngressMetrics(vtsMetrics)
+	updateRateLimitMetrics(vtsMetrics)
+
+	rateLimited, _ := rateLimitedRequests.GetMetricWithLabelValues("heapster.sandbox.cosmic.sky", "/")
+	assert.Equal(t, "feed_ingress_ingress_rate_limited_requests", metricName(rateLimited))
+	assert.Equal(t, 5.0, metricValue(rateLimited))
+	assertIngressRequestCounters(t,
+		"heapster.sandbox.cosmic.sky", "/",
+		2012.0, 1099.0, 0.0, 7.0, 0.0, 0.0, 0.0)
+}
+
+func TestIngressesLimitedByTheSameHeaderShareItsKey(t *testing.T) {
+	first := rateLimitedEntry("first", "/first")
+	first.RateLimitHeader = "X-Api-Key"
+	second := rateLimitedEntry("second", "/second")
+	second.RateLimitHeader = "x-api-key"
+	byIP := rateLimitedEntry("by-ip", "/ip")
+	unlimited := rateLimitedEntry("unlimited", "/unlimited")
+	unlimited.RateLimit = ""
+	unlimited.RateLimitHeader = "X-Other"
+
+	keys := rateLimitKeys(controller.IngressEntries{first, second, byIP, unlimited})
+
+	assert.Equal(t, []*rateLimitKey{{Variable: "$rate_limit_key_x_api_key", Header: "$http_x_api_key"}}, keys)
+}
+
+func TestRealNginxLimitsClientsWithoutTheHeaderByIP(t *testing.T) {
+	backend, paths := recordingBackend()
+	defer backend.Close()
+	entry := realNginxEntry(backend)
+	entry.RateLimit = "1r/m"
+	entry.RateLimitHeader = "X-Api-Key"
+	addr, stop := startRealNginx(t, nil, entry)
+	defer stop()
+
+	first := getFromRealNginx(t, addr, "/app/", "http")
+	second := getFromRealNginx(t, addr, "/app/", "http")
+
+	assert.Equal(t, http.StatusOK, first.StatusCode)
+	assert.Equal(t, http.StatusTooManyRequests, second.StatusCode)
+	assert.Len(t, paths(), 1)
+}
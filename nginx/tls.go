@@ -0,0 +1,184 @@
+package nginx
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+)
+
+// tlsCertificatesDir holds the certificates of ingress TLS secrets. It's only accessible by the owner, as it holds
+// private keys.
+func (c *Conf) tlsCertificatesDir() string {
+	return c.WorkingDir + "/tls"
+}
+
+// tlsCertificatePath returns the path of the certificate files without their .crt and .key extensions, like SSLPath.
+// Files are named after their content, so the config changes and nginx is reloaded whenever a certificate changes.
+func (c *Conf) tlsCertificatePath(cert *controller.TLSCertificate) string {
+	hash := sha256.New()
+	hash.Write(cert.Certificate)
+	hash.Write(cert.Key)
+	return fmt.Sprintf("%s/%s_%s_%x", c.tlsCertificatesDir(), cert.SecretNamespace, cert.SecretName, hash.Sum(nil)[:8])
+}
+
+func (c *Conf) servesHTTPS() bool {
+	for _, port := range c.Ports {
+		if port.Name == "https" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeTLSCertificates writes the certificate of every server which has one, and sets the path its config uses.
+// Servers without a certificate use SSLPath.
+func (n *nginxUpdater) writeTLSCertificates(servers []*server) error {
+	for _, s := range servers {
+		s.HTTPS.SSLPath = n.SSLPath
+	}
+	if !n.servesHTTPS() {
+		return nil
+	}
+	for _, s := range servers {
+		if s.TLSCertificate == nil {
+			continue
+		}
+		if err := os.MkdirAll(n.tlsCertificatesDir(), 0700); err != nil {
+			return err
+		}
+
+		path := n.tlsCertificatePath(s.TLSCertificate)
+		if err := writeFileIfMissing(path+".crt", s.TLSCertificate.Certificate); err != nil {
+			return fmt.Errorf("unable to write certificate of %s: %v", s.ServerName, err)
+		}
+		if err := writeFileIfMissing(path+".key", s.TLSCertificate.Key); err != nil {
+			return fmt.Errorf("unable to write certificate key of %s: %v", s.ServerName, err)
+		}
+		s.HTTPS.SSLPath = path
+	}
+	return nil
+}
+
+// writeFileIfMissing writes the file readable only by its owner. Files are replaced atomically, so nginx never
+// reads a partially written certificate.
+func writeFileIfMissing(file string, contents []byte) error {
+	if _, err := os.Stat(file); err == nil {
+		return nil
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(contents); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// removeUnusedTLSCertificates removes the certificate files which none of the entries use, once the config
+// using the entries has replaced the config that might have used them.
+func (n *nginxUpdater) removeUnusedTLSCertificates(entries controller.IngressEntries) {
+	files, err := ioutil.ReadDir(n.tlsCertificatesDir())
+	if err != nil {
+		return
+	}
+
+	used := make(map[string]bool)
+	for _, e := range entries {
+		if e.TLSCertificate != nil {
+			used[n.tlsCertificatePath(e.TLSCertificate)] = true
+		}
+	}
+	for _, file := range files {
+		path := n.tlsCertificatesDir() + "/" + file.Name()
+		if used[strings.TrimSuffix(strings.TrimSuffix(path, ".crt"), ".key")] {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			log.Warnf("Unable to remove unused certificate file %s: %v", path, err)
+		}
+	}
+}
+
+// periodicallyCheckDefaultCertificate reloads nginx when the SSLPath files change, such as when the Secret they are
+// mounted from is updated. Otherwise nginx would keep serving the old certificate until the next ingress change.
+func (n *nginxUpdater) periodicallyCheckDefaultCertificate() {
+	if !n.servesHTTPS() || n.SSLPath == "" {
+		return
+	}
+	ticker := time.NewTicker(defaultCertificateCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.doneCh:
+			return
+		case <-ticker.C:
+			n.checkDefaultCertificate()
+		}
+	}
+}
+
+// checkDefaultCertificate schedules a reload if the SSLPath files changed since they were last read, and updates
+// the expiry metric. Files which can't be read are ignored, so a partially updated Secret doesn't break nginx.
+func (n *nginxUpdater) checkDefaultCertificate() {
+	if !n.servesHTTPS() || n.SSLPath == "" {
+		return
+	}
+
+	certificate, err := ioutil.ReadFile(n.SSLPath + ".crt")
+	if err != nil {
+		log.Warnf("Unable to read the default certificate: %v", err)
+		return
+	}
+	key, err := ioutil.ReadFile(n.SSLPath + ".key")
+	if err != nil {
+		log.Warnf("Unable to read the default certificate key: %v", err)
+		return
+	}
+
+	hash := sha256.New()
+	hash.Write(certificate)
+	hash.Write(key)
+	contentHash := fmt.Sprintf("%x", hash.Sum(nil))
+	if n.defaultCertificateHash != "" && n.defaultCertificateHash != contentHash {
+		log.Infof("Default certificate %s changed, reloading nginx", n.SSLPath)
+		n.signalRequired()
+	}
+	n.defaultCertificateHash = contentHash
+
+	expiry, err := certificateExpiry(certificate)
+	if err != nil {
+		log.Warnf("Unable to parse the default certificate: %v", err)
+		return
+	}
+	defaultCertificateExpiry.Set(float64(expiry.Unix()))
+}
+
+// certificateExpiry returns the expiry of the first certificate of a PEM encoded chain, which is the server's own.
+func certificateExpiry(data []byte) (time.Time, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return time.Time{}, errors.New("no PEM encoded certificate found")
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return certificate.NotAfter, nil
+}
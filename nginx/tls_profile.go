@@ -0,0 +1,208 @@
+package nginx
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+	v1 "k8s.io/api/core/v1"
+)
+
+// DefaultTLSProfileName is the profile of servers which don't choose one. It's DefaultTLSProfile unless
+// Conf.TLSProfiles overrides it.
+const DefaultTLSProfileName = "default"
+
+// TLSProfile configures the TLS protocols, ciphers and sessions of a server.
+type TLSProfile struct {
+	// Protocols are the space separated nginx ssl_protocols, such as "TLSv1.2 TLSv1.3".
+	Protocols string
+	// Ciphers are the OpenSSL ciphers of TLSv1.2 and earlier. Empty to use the OpenSSL defaults.
+	Ciphers             string
+	PreferServerCiphers bool
+	// SessionTimeout is an nginx time, such as 1d.
+	SessionTimeout string
+	SessionTickets bool
+}
+
+// DefaultTLSProfile follows the Mozilla modern profile, https://mozilla.github.io/server-side-tls/ssl-config-generator/.
+var DefaultTLSProfile = TLSProfile{
+	Protocols: "TLSv1.2",
+	Ciphers: "ECDHE-ECDSA-AES256-GCM-SHA384:ECDHE-RSA-AES256-GCM-SHA384:ECDHE-ECDSA-CHACHA20-POLY1305:" +
+		"ECDHE-RSA-CHACHA20-POLY1305:ECDHE-ECDSA-AES128-GCM-SHA256:ECDHE-RSA-AES128-GCM-SHA256:" +
+		"ECDHE-ECDSA-AES256-SHA384:ECDHE-RSA-AES256-SHA384:ECDHE-ECDSA-AES128-SHA256:ECDHE-RSA-AES128-SHA256",
+	PreferServerCiphers: true,
+	SessionTimeout:      "1d",
+	SessionTickets:      false,
+}
+
+var (
+	tlsProfileNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	tlsProtocolPattern    = regexp.MustCompile(`^TLSv1(\.[123])?$`)
+	nginxTimePattern      = regexp.MustCompile(`^[0-9]+(ms|s|m|h|d|w|M|y)?$`)
+	opensslCiphersPattern = regexp.MustCompile(`^[-+!@=A-Za-z0-9_:.]+$`)
+)
+
+// ParseTLSProfile parses a profile in the form name:setting=value;setting=value, where the settings are
+// protocols, ciphers, prefer-server-ciphers, session-timeout and session-tickets. Settings which aren't given are
+// those of the DefaultTLSProfile. For example, modern:protocols=TLSv1.3;session-timeout=1h.
+func ParseTLSProfile(value string) (string, TLSProfile, error) {
+	profile := DefaultTLSProfile
+	parts := strings.SplitN(value, ":", 2)
+	name := parts[0]
+	if !tlsProfileNamePattern.MatchString(name) {
+		return "", profile, fmt.Errorf("invalid TLS profile name %q: must be lower case alphanumeric characters or '-'", name)
+	}
+	if len(parts) == 1 {
+		return name, profile, nil
+	}
+
+	for _, setting := range strings.Split(parts[1], ";") {
+		if setting == "" {
+			continue
+		}
+		kv := strings.SplitN(setting, "=", 2)
+		if len(kv) != 2 {
+			return "", profile, fmt.Errorf("invalid setting %q of TLS profile %s: must be setting=value", setting, name)
+		}
+		if err := profile.set(kv[0], kv[1]); err != nil {
+			return "", profile, fmt.Errorf("invalid setting %q of TLS profile %s: %v", setting, name, err)
+		}
+	}
+	return name, profile, nil
+}
+
+func (p *TLSProfile) set(setting, value string) error {
+	switch setting {
+	case "protocols":
+		protocols := strings.Fields(strings.Replace(value, ",", " ", -1))
+		if len(protocols) == 0 {
+			return errors.New("no protocols")
+		}
+		for _, protocol := range protocols {
+			if !tlsProtocolPattern.MatchString(protocol) {
+				return fmt.Errorf("unknown protocol %s", protocol)
+			}
+		}
+		p.Protocols = strings.Join(protocols, " ")
+	case "ciphers":
+		if value != "" && !opensslCiphersPattern.MatchString(value) {
+			return errors.New("must be an OpenSSL cipher list")
+		}
+		p.Ciphers = value
+	case "prefer-server-ciphers":
+		return parseOnOff(value, &p.PreferServerCiphers)
+	case "session-timeout":
+		if !nginxTimePattern.MatchString(value) {
+			return errors.New("must be an nginx time, such as 1d")
+		}
+		p.SessionTimeout = value
+	case "session-tickets":
+		return parseOnOff(value, &p.SessionTickets)
+	default:
+		return errors.New("unknown setting")
+	}
+	return nil
+}
+
+func parseOnOff(value string, field *bool) error {
+	switch value {
+	case "on":
+		*field = true
+	case "off":
+		*field = false
+	default:
+		return errors.New("must be on or off")
+	}
+	return nil
+}
+
+// TLSProfileNames returns the names of the profiles servers can choose, including the default profile.
+func TLSProfileNames(profiles map[string]TLSProfile) []string {
+	names := []string{DefaultTLSProfileName}
+	for name := range profiles {
+		if name != DefaultTLSProfileName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// defaultServerTLSProfile returns the default profile with the protocols of every profile. nginx negotiates the
+// protocol with the default server of the port before SNI selects the server of the host, so the default server
+// must allow every protocol a profile uses.
+func (c *Conf) defaultServerTLSProfile() TLSProfile {
+	profile := c.tlsProfile(DefaultTLSProfileName)
+	protocols := map[string]bool{}
+	for _, protocol := range strings.Fields(profile.Protocols) {
+		protocols[protocol] = true
+	}
+	for _, p := range c.TLSProfiles {
+		for _, protocol := range strings.Fields(p.Protocols) {
+			protocols[protocol] = true
+		}
+	}
+	var union []string
+	for protocol := range protocols {
+		union = append(union, protocol)
+	}
+	// Protocol names sort from oldest to newest.
+	sort.Strings(union)
+	profile.Protocols = strings.Join(union, " ")
+	return profile
+}
+
+// tlsProfile returns the named profile, or the default profile if the name is empty or unknown.
+func (c *Conf) tlsProfile(name string) TLSProfile {
+	if profile, ok := c.TLSProfiles[name]; ok {
+		return profile
+	}
+	if profile, ok := c.TLSProfiles[DefaultTLSProfileName]; ok {
+		return profile
+	}
+	return DefaultTLSProfile
+}
+
+// preferredTLSProfile chooses between the profiles of the entries of a server consistently, whatever their order, if
+// ingresses for the same host choose different profiles.
+func preferredTLSProfile(a, b string) string {
+	if a == "" || (b != "" && b < a) {
+		return b
+	}
+	return a
+}
+
+// reportTLSProfileConflicts reports the entries whose TLS profile isn't used, as another ingress for the same host
+// chose a different one. Like servers, it ignores entries duplicating the host and path of another entry. Events are
+// only recorded for conflicts which weren't reported by the previous update.
+func (n *nginxUpdater) reportTLSProfileConflicts(entries controller.IngressEntries) {
+	entries = uniqueIngressEntries(append(controller.IngressEntries(nil), entries...))
+	hostProfiles := make(map[string]string)
+	for _, entry := range entries {
+		hostProfiles[entry.Host] = preferredTLSProfile(hostProfiles[entry.Host], entry.TLSProfile)
+	}
+
+	conflicts := make(map[string]string)
+	for _, entry := range entries {
+		used := hostProfiles[entry.Host]
+		if entry.TLSProfile == "" || entry.TLSProfile == used {
+			continue
+		}
+		key := entry.String()
+		conflicts[key] = entry.TLSProfile
+		log.Warnf("Ignoring TLS profile %s of %s, as host %s uses TLS profile %s", entry.TLSProfile, entry, entry.Host, used)
+
+		if reported, ok := n.tlsProfileConflicts[key]; (ok && reported == entry.TLSProfile) || n.EventRecorder == nil ||
+			entry.Ingress == nil {
+			continue
+		}
+		n.EventRecorder.Eventf(entry.Ingress, v1.EventTypeWarning, tlsProfileConflictEventReason,
+			"TLS profile %s isn't used, as another ingress of host %s chooses TLS profile %s",
+			entry.TLSProfile, entry.Host, used)
+	}
+	n.tlsProfileConflicts = conflicts
+}
@@ -0,0 +1,159 @@
+package nginx
+
+import (
+	"os"
+	"testing"
+
+	"github.com/sky-uk/feed/controller"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestParseTLSProfile(t *testing.T) {
+	modern := DefaultTLSProfile
+	modern.Protocols = "TLSv1.3"
+	modern.Ciphers = ""
+	modern.SessionTimeout = "1h"
+
+	legacy := DefaultTLSProfile
+	legacy.Protocols = "TLSv1 TLSv1.1 TLSv1.2"
+	legacy.PreferServerCiphers = false
+	legacy.SessionTickets = true
+
+	var tests = []struct {
+		value    string
+		name     string
+		profile  TLSProfile
+		errorMsg string
+	}{
+		{"plain", "plain", DefaultTLSProfile, ""},
+		{"modern:protocols=TLSv1.3;ciphers=;session-timeout=1h", "modern", modern, ""},
+		{"legacy:protocols=TLSv1,TLSv1.1,TLSv1.2;prefer-server-ciphers=off;session-tickets=on;", "legacy", legacy, ""},
+		{"Modern:protocols=TLSv1.3", "", TLSProfile{}, `invalid TLS profile name "Modern"`},
+		{"modern:protocols=SSLv3", "", TLSProfile{}, "unknown protocol SSLv3"},
+		{"modern:protocols", "", TLSProfile{}, "must be setting=value"},
+		{"modern:session-timeout=forever", "", TLSProfile{}, "must be an nginx time"},
+		{"modern:session-tickets=true", "", TLSProfile{}, "must be on or off"},
+		{"modern:ciphers=AES';", "", TLSProfile{}, "must be an OpenSSL cipher list"},
+		{"modern:curves=X25519", "", TLSProfile{}, "unknown setting"},
+	}
+
+	for _, test := range tests {
+		name, profile, err := ParseTLSProfile(test.value)
+		if test.errorMsg != "" {
+			assert.Error(t, err, test.value)
+			if err != nil {
+				assert.Contains(t, err.Error(), test.errorMsg, test.value)
+			}
+			continue
+		}
+		assert.NoError(t, err, test.value)
+		assert.Equal(t, test.name, name, test.value)
+		assert.Equal(t, test.profile, profile, test.value)
+	}
+}
+
+func TestServersUseTheirTLSProfile(t *testing.T) {
+	tmpDir := setupWorkDir(t)
+	defer os.RemoveAll(tmpDir)
+	n := newTLSUpdater(tmpDir)
+	modern := DefaultTLSProfile
+	modern.Protocols = "TLSv1.3"
+	modern.Ciphers = ""
+	legacy := DefaultTLSProfile
+	legacy.Protocols = "TLSv1.2"
+	legacy.PreferServerCiphers = false
+	n.TLSProfiles = map[string]TLSProfile{"modern": modern, DefaultTLSProfileName: legacy}
+	withProfile := tlsEntry("modern.com", "", "")
+	withProfile.TLSCertificate = nil
+	withProfile.TLSProfile = "modern"
+	withoutProfile := tlsEntry("default.com", "", "")
+	withoutProfile.TLSCertificate = nil
+
+	config, err := n.createConfig(controller.IngressEntries{withProfile, withoutProfile})
+	require.NoError(t, err)
+
+	assertConfigEntries(t, "profiles", "server", `(?sU)(server_name .+;.+ssl_prefer_server_ciphers .+;)`, []string{
+		"server_name default.com;\n\n" +
+			"        # TLS profile, based on https://mozilla.github.io/server-side-tls/ssl-config-generator/\n" +
+			"        ssl_certificate /etc/ssl/default.crt;\n" +
+			"        ssl_certificate_key /etc/ssl/default.key;\n" +
+			"        ssl_session_timeout 1d;\n" +
+			"        ssl_session_cache shared:SSL:50m;\n" +
+			"        ssl_session_tickets off;\n" +
+			"        ssl_protocols TLSv1.2;\n" +
+			"        ssl_ciphers '" + DefaultTLSProfile.Ciphers + "';\n" +
+			"        ssl_prefer_server_ciphers off;",
+		"server_name modern.com;\n\n" +
+			"        # TLS profile, based on https://mozilla.github.io/server-side-tls/ssl-config-generator/\n" +
+			"        ssl_certificate /etc/ssl/default.crt;\n" +
+			"        ssl_certificate_key /etc/ssl/default.key;\n" +
+			"        ssl_session_timeout 1d;\n" +
+			"        ssl_session_cache shared:SSL:50m;\n" +
+			"        ssl_session_tickets off;\n" +
+			"        ssl_protocols TLSv1.3;\n" +
+			"        ssl_prefer_server_ciphers on;",
+	}, string(config))
+}
+
+func TestConflictingTLSProfilesOfAHostAreReported(t *testing.T) {
+	tmpDir := setupWorkDir(t)
+	defer os.RemoveAll(tmpDir)
+	n := newTLSUpdater(tmpDir)
+	recorder := record.NewFakeRecorder(10)
+	n.EventRecorder = recorder
+	profileEntry := func(name, profile string) controller.IngressEntry {
+		entry := tlsEntry("shared.com", "", "")
+		entry.Name = name
+		entry.Path = "/" + name
+		entry.TLSCertificate = nil
+		entry.TLSProfile = profile
+		entry.Ingress = &networkingv1.Ingress{}
+		return entry
+	}
+	modern := profileEntry("modern", "modern")
+	legacy := profileEntry("legacy", "legacy")
+	duplicate := profileEntry("legacy", "ignored")
+	duplicate.Name = "other"
+	entries := controller.IngressEntries{modern, legacy, profileEntry("default", ""), duplicate}
+
+	n.reportTLSProfileConflicts(entries)
+
+	assert.Equal(t, "Warning TLSProfileConflict TLS profile modern isn't used, as another ingress of host shared.com "+
+		"chooses TLS profile legacy", <-recorder.Events)
+	assert.Empty(t, recorder.Events)
+	servers := createServerEntries(entries)
+	require.Len(t, servers, 1)
+	assert.Equal(t, "legacy", servers[0].TLSProfile)
+
+	// the event is only recorded when the conflict starts
+	n.reportTLSProfileConflicts(entries)
+	assert.Empty(t, recorder.Events)
+
+	n.reportTLSProfileConflicts(controller.IngressEntries{modern})
+	n.reportTLSProfileConflicts(entries)
+	assert.Len(t, recorder.Events, 1)
+}
+
+func TestDefaultServerAllowsTheProtocolsOfEveryProfile(t *testing.T) {
+	tmpDir := setupWorkDir(t)
+	defer os.RemoveAll(tmpDir)
+	n := newTLSUpdater(tmpDir)
+	modern := DefaultTLSProfile
+	modern.Protocols = "TLSv1.3"
+	legacy := DefaultTLSProfile
+	legacy.Protocols = "TLSv1 TLSv1.1 TLSv1.2"
+	legacy.PreferServerCiphers = false
+	n.TLSProfiles = map[string]TLSProfile{"modern": modern, "legacy": legacy}
+
+	config, err := n.createConfig(controller.IngressEntries{})
+	require.NoError(t, err)
+
+	assertConfigEntries(t, "default server", "server", `(?sU)(default_server;.+ssl_prefer_server_ciphers .+;)`, []string{
+		"ssl_protocols TLSv1 TLSv1.1 TLSv1.2 TLSv1.3;\n" +
+			"        ssl_ciphers '" + DefaultTLSProfile.Ciphers + "';\n" +
+			"        ssl_prefer_server_ciphers on;",
+	}, string(config))
+}
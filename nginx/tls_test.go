@@ -0,0 +1,178 @@
+package nginx
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sky-uk/feed/controller"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTLSUpdater(tmpDir string) *nginxUpdater {
+	conf := newConf(tmpDir, fakeNginx)
+	conf.Ports = []Port{{Name: "https", Port: 443}}
+	conf.SSLPath = "/etc/ssl/default"
+	return New(conf).(*nginxUpdater)
+}
+
+func tlsEntry(host, secretName, certificate string) controller.IngressEntry {
+	return controller.IngressEntry{
+		Host:           host,
+		Namespace:      "core",
+		Name:           host + "-ingress",
+		Path:           "/path",
+		ServiceAddress: "service",
+		ServicePort:    9090,
+		TLSCertificate: &controller.TLSCertificate{
+			SecretNamespace: "core",
+			SecretName:      secretName,
+			Certificate:     []byte(certificate),
+			Key:             []byte(certificate + " key"),
+		},
+	}
+}
+
+func TestServersUseCertificatesOfTheirSecrets(t *testing.T) {
+	tmpDir := setupWorkDir(t)
+	defer os.RemoveAll(tmpDir)
+	n := newTLSUpdater(tmpDir)
+	withSecret := tlsEntry("secret.com", "cert", "certificate")
+	withoutSecret := tlsEntry("default.com", "", "")
+	withoutSecret.TLSCertificate = nil
+
+	config, err := n.createConfig(controller.IngressEntries{withSecret, withoutSecret})
+	require.NoError(t, err)
+
+	path := n.tlsCertificatePath(withSecret.TLSCertificate)
+	assertConfigEntries(t, "certificates", "server", `(?sU)(server_name .+;\n.*\n\s+ssl_certificate .+;)`, []string{
+		"server_name default.com;\n\n" +
+			"        # TLS profile, based on https://mozilla.github.io/server-side-tls/ssl-config-generator/\n" +
+			"        ssl_certificate /etc/ssl/default.crt;",
+		"server_name secret.com;\n\n" +
+			"        # TLS profile, based on https://mozilla.github.io/server-side-tls/ssl-config-generator/\n" +
+			"        ssl_certificate " + path + ".crt;",
+	}, string(config))
+	assert.Contains(t, string(config), "ssl_certificate_key "+path+".key;")
+
+	certificate, err := ioutil.ReadFile(path + ".crt")
+	assert.NoError(t, err)
+	assert.Equal(t, "certificate", string(certificate))
+	key, err := os.Stat(path + ".key")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), key.Mode().Perm(), "keys should only be readable by their owner")
+	dir, err := os.Stat(n.tlsCertificatesDir())
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), dir.Mode().Perm())
+}
+
+func TestChangedCertificateChangesConfig(t *testing.T) {
+	tmpDir := setupWorkDir(t)
+	defer os.RemoveAll(tmpDir)
+	n := newTLSUpdater(tmpDir)
+
+	config, err := n.createConfig(controller.IngressEntries{tlsEntry("secret.com", "cert", "old")})
+	require.NoError(t, err)
+	rotatedConfig, err := n.createConfig(controller.IngressEntries{tlsEntry("secret.com", "cert", "new")})
+	require.NoError(t, err)
+
+	assert.NotEqual(t, string(config), string(rotatedConfig), "nginx should be reloaded when a certificate changes")
+}
+
+func TestUnusedCertificatesAreRemoved(t *testing.T) {
+	tmpDir := setupWorkDir(t)
+	defer os.RemoveAll(tmpDir)
+	n := newTLSUpdater(tmpDir)
+	old := controller.IngressEntries{tlsEntry("secret.com", "cert", "old")}
+	current := controller.IngressEntries{tlsEntry("secret.com", "cert", "new")}
+	_, err := n.createConfig(old)
+	require.NoError(t, err)
+	_, err = n.createConfig(current)
+	require.NoError(t, err)
+
+	n.removeUnusedTLSCertificates(current)
+
+	files, err := ioutil.ReadDir(n.tlsCertificatesDir())
+	require.NoError(t, err)
+	var names []string
+	for _, file := range files {
+		names = append(names, n.tlsCertificatesDir()+"/"+file.Name())
+	}
+	path := n.tlsCertificatePath(current[0].TLSCertificate)
+	assert.ElementsMatch(t, []string{path + ".crt", path + ".key"}, names)
+}
+
+func TestServersChooseTheSameCertificateWhateverTheEntryOrder(t *testing.T) {
+	a := tlsEntry("secret.com", "a", "a")
+	b := tlsEntry("secret.com", "b", "b")
+	b.Path = "/other"
+
+	for _, entries := range []controller.IngressEntries{{a, b}, {b, a}} {
+		servers := createServerEntries(entries)
+		require.Len(t, servers, 1)
+		assert.Equal(t, "a", servers[0].TLSCertificate.SecretName)
+	}
+}
+
+func writeSelfSignedCertificate(t *testing.T, path string, notAfter time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "default"},
+		NotBefore:    notAfter.Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, ioutil.WriteFile(path+".crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}), 0600))
+	require.NoError(t, ioutil.WriteFile(path+".key", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600))
+}
+
+func TestReloadIsRequiredWhenDefaultCertificateChanges(t *testing.T) {
+	tmpDir := setupWorkDir(t)
+	defer os.RemoveAll(tmpDir)
+	n := newTLSUpdater(tmpDir)
+	n.SSLPath = tmpDir + "/default"
+	expiry := time.Now().Add(time.Hour * 24).Truncate(time.Second)
+	writeSelfSignedCertificate(t, n.SSLPath, expiry)
+
+	n.checkDefaultCertificate()
+	assert.False(t, n.updateRequired.Get(), "reading the certificate for the first time shouldn't reload nginx")
+	assert.Equal(t, float64(expiry.Unix()), metricValue(defaultCertificateExpiry))
+
+	n.checkDefaultCertificate()
+	assert.False(t, n.updateRequired.Get(), "unchanged certificate shouldn't reload nginx")
+
+	rotatedExpiry := expiry.Add(time.Hour * 24 * 30)
+	writeSelfSignedCertificate(t, n.SSLPath, rotatedExpiry)
+	n.checkDefaultCertificate()
+	assert.True(t, n.updateRequired.Get(), "changed certificate should reload nginx")
+	assert.Equal(t, float64(rotatedExpiry.Unix()), metricValue(defaultCertificateExpiry))
+}
+
+func TestMissingDefaultCertificateDoesNotReloadNginx(t *testing.T) {
+	tmpDir := setupWorkDir(t)
+	defer os.RemoveAll(tmpDir)
+	n := newTLSUpdater(tmpDir)
+	n.SSLPath = tmpDir + "/default"
+	writeSelfSignedCertificate(t, n.SSLPath, time.Now().Add(time.Hour))
+	n.checkDefaultCertificate()
+
+	require.NoError(t, os.Remove(n.SSLPath+".key"))
+	n.checkDefaultCertificate()
+
+	assert.False(t, n.updateRequired.Get())
+}
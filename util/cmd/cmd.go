@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -16,6 +17,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/push"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
 	"github.com/sky-uk/feed/util/metrics"
 )
 
@@ -27,9 +29,26 @@ type Pulse interface {
 	Stop() error
 }
 
-// AddHealthPort is used to expose the health over http.
+// healthReporter is a Pulse which describes the health of each of its parts, such as the feed controller.
+type healthReporter interface {
+	HealthReport() controller.HealthReport
+}
+
+// removalOverrider is a Pulse which refuses updates that remove too many entries, such as the feed controller.
+type removalOverrider interface {
+	OverrideRemovalThreshold()
+}
+
+// AddHealthPort is used to expose the health over http. If the pulse is a controller, /health is only
+// unhealthy if restarting could help, so is suitable for liveness probes, while /ready is unhealthy
+// whenever updates fail. Both respond with a JSON health report. A POST to /override-removal-threshold
+// allows the next update of a controller to remove any number of entries.
 func AddHealthPort(pulse Pulse, healthPort int) {
-	http.HandleFunc("/health", healthHandler(pulse))
+	http.HandleFunc("/health", healthHandler(pulse, false))
+	http.HandleFunc("/ready", healthHandler(pulse, true))
+	if overrider, ok := pulse.(removalOverrider); ok {
+		http.HandleFunc("/override-removal-threshold", overrideRemovalThresholdHandler(overrider))
+	}
 	http.Handle("/metrics", promhttp.Handler())
 	http.HandleFunc("/alive", okHandler)
 
@@ -40,8 +59,22 @@ func AddHealthPort(pulse Pulse, healthPort int) {
 	}()
 }
 
-func healthHandler(pulse Pulse) func(w http.ResponseWriter, r *http.Request) {
+func healthHandler(pulse Pulse, ready bool) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if reporter, ok := pulse.(healthReporter); ok {
+			report := reporter.HealthReport()
+			w.Header().Set("Content-Type", "application/json")
+			if (ready && !report.Ready) || (!ready && !report.Alive) {
+				w.WriteHeader(http.StatusInternalServerError)
+			} else {
+				w.WriteHeader(http.StatusOK)
+			}
+			if err := json.NewEncoder(w).Encode(report); err != nil {
+				log.Warnf("Unable to write health report: %v", err)
+			}
+			return
+		}
+
 		if err := pulse.Health(); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			_, _ = io.WriteString(w, fmt.Sprintf("%v\n", err))
@@ -53,6 +86,20 @@ func healthHandler(pulse Pulse) func(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func overrideRemovalThresholdHandler(overrider removalOverrider) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		log.Warnf("Removal threshold overridden by %s", r.RemoteAddr)
+		overrider.OverrideRemovalThreshold()
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, "ok\n")
+	}
+}
+
 func okHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	_, _ = io.WriteString(w, "ok\n")
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sky-uk/feed/controller"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePulse struct {
+	err error
+}
+
+func (p *fakePulse) Health() error { return p.err }
+func (p *fakePulse) Stop() error   { return nil }
+
+type fakeReporter struct {
+	fakePulse
+	report controller.HealthReport
+}
+
+func (r *fakeReporter) HealthReport() controller.HealthReport { return r.report }
+
+func TestHealthHandlerRespondsWithHealthReport(t *testing.T) {
+	asserter := assert.New(t)
+	report := controller.HealthReport{
+		Alive: true,
+		Ready: false,
+		Updaters: []controller.UpdaterHealth{
+			{Name: "route53 updater", Status: controller.UpdaterFailing, LastUpdateError: "throttled", ConsecutiveFailures: 2},
+		},
+	}
+	pulse := &fakeReporter{report: report}
+
+	var tests = []struct {
+		ready          bool
+		expectedStatus int
+	}{
+		{false, http.StatusOK},
+		{true, http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		healthHandler(pulse, test.ready)(recorder, httptest.NewRequest("GET", "/", nil))
+
+		asserter.Equal(test.expectedStatus, recorder.Code)
+		asserter.Equal("application/json", recorder.Header().Get("Content-Type"))
+		var body controller.HealthReport
+		asserter.NoError(json.Unmarshal(recorder.Body.Bytes(), &body))
+		asserter.Equal(report, body)
+	}
+}
+
+func TestHealthHandlerRespondsWithErrorOfOtherPulses(t *testing.T) {
+	asserter := assert.New(t)
+
+	recorder := httptest.NewRecorder()
+	healthHandler(&fakePulse{}, false)(recorder, httptest.NewRequest("GET", "/", nil))
+	asserter.Equal(http.StatusOK, recorder.Code)
+	asserter.Equal("ok\n", recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	healthHandler(&fakePulse{err: errors.New("dead")}, true)(recorder, httptest.NewRequest("GET", "/", nil))
+	asserter.Equal(http.StatusInternalServerError, recorder.Code)
+	asserter.Equal("dead\n", recorder.Body.String())
+}
+
+type fakeOverrider struct {
+	overridden int
+}
+
+func (o *fakeOverrider) OverrideRemovalThreshold() { o.overridden++ }
+
+func TestOverrideRemovalThresholdHandlerOnlyAcceptsPost(t *testing.T) {
+	asserter := assert.New(t)
+	overrider := &fakeOverrider{}
+
+	recorder := httptest.NewRecorder()
+	overrideRemovalThresholdHandler(overrider)(recorder, httptest.NewRequest("GET", "/", nil))
+	asserter.Equal(http.StatusMethodNotAllowed, recorder.Code)
+	asserter.Equal(0, overrider.overridden)
+
+	recorder = httptest.NewRecorder()
+	overrideRemovalThresholdHandler(overrider)(recorder, httptest.NewRequest("POST", "/", nil))
+	asserter.Equal(http.StatusOK, recorder.Code)
+	asserter.Equal(1, overrider.overridden)
+}
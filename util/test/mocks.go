@@ -4,24 +4,28 @@ import (
 	"github.com/sky-uk/feed/k8s"
 	"github.com/stretchr/testify/mock"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
 )
 
 // FakeClient mocks out the Kubernetes client
 type FakeClient struct {
 	mock.Mock
+	// Stopped is set by Stop, which doesn't need to be expected as every controller stops its client.
+	Stopped bool
 }
 
 // GetAllIngresses mocks out calls to GetAllIngresses
-func (c *FakeClient) GetAllIngresses() ([]*v1beta1.Ingress, error) {
+func (c *FakeClient) GetAllIngresses() ([]*networkingv1.Ingress, error) {
 	r := c.Called()
-	return r.Get(0).([]*v1beta1.Ingress), r.Error(1)
+	return r.Get(0).([]*networkingv1.Ingress), r.Error(1)
 }
 
 // GetIngresses mocks out calls to GetIngresses
-func (c *FakeClient) GetIngresses(selector *k8s.NamespaceSelector) ([]*v1beta1.Ingress, error) {
+func (c *FakeClient) GetIngresses(selector *k8s.NamespaceSelector) ([]*networkingv1.Ingress, error) {
 	r := c.Called(selector)
-	return r.Get(0).([]*v1beta1.Ingress), r.Error(1)
+	return r.Get(0).([]*networkingv1.Ingress), r.Error(1)
 }
 
 // WatchIngresses mocks out calls to WatchIngresses
@@ -42,18 +46,71 @@ func (c *FakeClient) WatchServices() k8s.Watcher {
 	return r.Get(0).(k8s.Watcher)
 }
 
+// GetEndpoints mocks out calls to GetEndpoints
+func (c *FakeClient) GetEndpoints() ([]*v1.Endpoints, error) {
+	r := c.Called()
+	return r.Get(0).([]*v1.Endpoints), r.Error(1)
+}
+
+// WatchEndpoints mocks out calls to WatchEndpoints
+func (c *FakeClient) WatchEndpoints() k8s.Watcher {
+	r := c.Called()
+	return r.Get(0).(k8s.Watcher)
+}
+
+// GetIngressClasses mocks out calls to GetIngressClasses
+func (c *FakeClient) GetIngressClasses() ([]*networkingv1.IngressClass, error) {
+	r := c.Called()
+	return r.Get(0).([]*networkingv1.IngressClass), r.Error(1)
+}
+
+// WatchIngressClasses mocks out calls to WatchIngressClasses
+func (c *FakeClient) WatchIngressClasses() k8s.Watcher {
+	r := c.Called()
+	return r.Get(0).(k8s.Watcher)
+}
+
 // WatchNamespaces mocks out calls to WatchNamespaces
 func (c *FakeClient) WatchNamespaces() k8s.Watcher {
 	r := c.Called()
 	return r.Get(0).(k8s.Watcher)
 }
 
+// GetSecrets mocks out calls to GetSecrets
+func (c *FakeClient) GetSecrets() ([]*v1.Secret, error) {
+	r := c.Called()
+	return r.Get(0).([]*v1.Secret), r.Error(1)
+}
+
+// WatchSecrets mocks out calls to WatchSecrets
+func (c *FakeClient) WatchSecrets() k8s.Watcher {
+	r := c.Called()
+	return r.Get(0).(k8s.Watcher)
+}
+
 // UpdateIngressStatus mocks out calls to UpdateIngressStatus
-func (c *FakeClient) UpdateIngressStatus(*v1beta1.Ingress) error {
+func (c *FakeClient) UpdateIngressStatus(*networkingv1.Ingress) error {
 	r := c.Called()
 	return r.Error(0)
 }
 
+// EventRecorder mocks out calls to EventRecorder
+func (c *FakeClient) EventRecorder(component string) record.EventRecorder {
+	r := c.Called(component)
+	return r.Get(0).(record.EventRecorder)
+}
+
+// LeaseLock mocks out calls to LeaseLock
+func (c *FakeClient) LeaseLock(namespace, name, identity string) resourcelock.Interface {
+	r := c.Called(namespace, name, identity)
+	return r.Get(0).(resourcelock.Interface)
+}
+
 func (c *FakeClient) String() string {
 	return "FakeClient"
 }
+
+// Stop records that the client was stopped
+func (c *FakeClient) Stop() {
+	c.Stopped = true
+}